@@ -1,3 +1,3 @@
 module go.neonxp.dev/jsonrpc2
 
-go 1.18
+go 1.20
@@ -20,33 +20,183 @@
 package http
 
 import (
-	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strings"
+	"time"
 
 	"go.neonxp.dev/jsonrpc2/rpc"
 )
 
 type Server struct {
 	*rpc.RpcServer
+	// Codecs maps media types other than application/json to codecs. A
+	// request body with such a Content-Type is decoded by its codec, and the
+	// response is encoded by the codec of the first such type in Accept.
+	// Everything else is plain JSON.
+	Codecs map[string]Codec
+	// ReadinessPath, if set, is answered with 200 OK when the server is Ready
+	// and 503 Service Unavailable otherwise, e.g. for a Kubernetes readiness
+	// probe, instead of handling JSON-RPC.
+	ReadinessPath string
 }
 
-func New() *Server {
-	return &Server{RpcServer: rpc.New()}
+// Codec converts messages between JSON and another encoding, e.g. MessagePack.
+type Codec interface {
+	// Decode converts a request body to JSON.
+	Decode(body []byte) ([]byte, error)
+	// Encode converts a JSON response to the codec's encoding.
+	Encode(resp []byte) ([]byte, error)
+}
+
+func New(opts ...rpc.Option) *Server {
+	return &Server{RpcServer: rpc.New(opts...)}
 }
 
 func (r *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	writer.Header().Set("Content-Type", "application/json")
-	reader := bufio.NewReader(request.Body)
 	defer request.Body.Close()
-	firstByte, err := reader.Peek(1)
-	if err != nil {
-		r.Logger.Logf("Can't read body: %v", err)
-		rpc.WriteError(rpc.ErrCodeParseError, writer)
+	if r.ReadinessPath != "" && request.URL.Path == r.ReadinessPath {
+		if !r.Ready() {
+			http.Error(writer, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
 		return
 	}
-	if string(firstByte) == "[" {
-		r.BatchRequest(request.Context(), reader, writer)
+	if flusher, ok := writer.(http.Flusher); ok && acceptsEventStream(request) {
+		r.serveEvents(writer, flusher, request)
 		return
 	}
-	r.SingleRequest(request.Context(), reader, writer)
+	if r.WriteTimeout > 0 {
+		// not every ResponseWriter supports deadlines; those are left unbounded
+		_ = http.NewResponseController(writer).SetWriteDeadline(time.Now().Add(r.WriteTimeout))
+	}
+	ctx, accepted := rpc.TrackAccepted(request.Context())
+	request = request.WithContext(ctx)
+	writer = &acceptedWriter{ResponseWriter: writer, accepted: accepted}
+	in, inType := r.requestCodec(request)
+	out, outType := r.responseCodec(request)
+	if in == nil && out == nil {
+		writer.Header().Set("Content-Type", "application/json")
+		r.Handle(request.Context(), request.Body, writer)
+		return
+	}
+	resp := r.handleCodec(request, in, inType)
+	if resp == nil {
+		return
+	}
+	contentType := "application/json"
+	if out != nil {
+		encoded, err := out.Encode(resp)
+		if err != nil {
+			r.Log(request.Context()).Logf("Can't encode response as %s: %v", outType, err)
+			http.Error(writer, "can't encode response", http.StatusInternalServerError)
+			return
+		}
+		resp, contentType = encoded, outType
+	}
+	writer.Header().Set("Content-Type", contentType)
+	if _, err := writer.Write(resp); err != nil {
+		r.Log(request.Context()).Logf("Can't write response: %v", err)
+	}
+}
+
+// handleCodec reads the whole request, decoding it with in if not nil, and
+// returns the JSON response.
+func (r *Server) handleCodec(request *http.Request, in Codec, inType string) []byte {
+	body, err := io.ReadAll(request.Body)
+	if err == nil && in != nil {
+		if body, err = in.Decode(body); err != nil {
+			err = fmt.Errorf("can't decode %s: %w", inType, err)
+		}
+	}
+	if err != nil {
+		r.Log(request.Context()).Logf("Can't read body: %v", err)
+		buf := new(bytes.Buffer)
+		r.WriteError(rpc.ErrCodeParseError, buf)
+		return buf.Bytes()
+	}
+	return r.HandleBytes(request.Context(), body)
+}
+
+func (r *Server) requestCodec(request *http.Request) (Codec, string) {
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, ""
+	}
+	return r.Codecs[mediaType], mediaType
+}
+
+func (r *Server) responseCodec(request *http.Request) (Codec, string) {
+	for _, accept := range strings.Split(request.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		if mediaType == "application/json" {
+			return nil, ""
+		}
+		if codec, ok := r.Codecs[mediaType]; ok {
+			return codec, mediaType
+		}
+	}
+	return nil, ""
+}
+
+// serveEvents answers with Server-Sent Events, one "data" event per response
+// as soon as it is ready. Clients get the responses of a long batch
+// incrementally, in completion order.
+func (r *Server) serveEvents(writer http.ResponseWriter, flusher http.Flusher, request *http.Request) {
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		r.Log(request.Context()).Logf("Can't read body: %v", err)
+		body = nil
+	}
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	r.HandleBytesStream(request.Context(), body, func(resp []byte) {
+		if _, err := fmt.Fprintf(writer, "data: %s\n\n", resp); err != nil {
+			r.Log(request.Context()).Logf("Can't write event: %v", err)
+			return
+		}
+		flusher.Flush()
+	})
+}
+
+func acceptsEventStream(request *http.Request) bool {
+	for _, accept := range strings.Split(request.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptedWriter answers with status 202 if all calls of the request returned
+// rpc.Accepted. Responses are written after all calls completed, so the first
+// write knows.
+type acceptedWriter struct {
+	http.ResponseWriter
+	accepted    func() bool
+	wroteHeader bool
+}
+
+func (w *acceptedWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *acceptedWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		status := http.StatusOK
+		if w.accepted() {
+			status = http.StatusAccepted
+		}
+		w.WriteHeader(status)
+	}
+	return w.ResponseWriter.Write(b)
 }
@@ -0,0 +1,155 @@
+package http
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.neonxp.dev/jsonrpc2/rpc"
+)
+
+func TestAcceptedStatus(t *testing.T) {
+	s := New()
+	s.MaxParamsDepth = 1
+	s.MaxPerBatch = map[string]int{"a": 2}
+	s.Register("a", rpc.Wrap(func(ctx context.Context, params *[]any) (rpc.Accepted, error) {
+		return rpc.Accepted{TrackingID: "t"}, nil
+	}))
+	s.Register("b", rpc.Wrap(func(ctx context.Context, params *[]any) (int, error) {
+		return 1, nil
+	}))
+	for name, tc := range map[string]struct {
+		body   string
+		status int
+	}{
+		"accepted":             {`{"jsonrpc":"2.0","method":"a","params":[],"id":1}`, http.StatusAccepted},
+		"accepted batch":       {`[{"jsonrpc":"2.0","method":"a","params":[],"id":1},{"jsonrpc":"2.0","method":"a","params":[]}]`, http.StatusAccepted},
+		"mixed batch":          {`[{"jsonrpc":"2.0","method":"a","params":[],"id":1},{"jsonrpc":"2.0","method":"b","params":[],"id":2}]`, http.StatusOK},
+		"rejected by dispatch": {`[{"jsonrpc":"2.0","method":"a","params":[],"id":1},{"jsonrpc":"2.0","method":"a","params":[[1]],"id":2}]`, http.StatusOK},
+		"invalid batch member": {`[{"jsonrpc":"2.0","method":"a","params":[],"id":1},5]`, http.StatusOK},
+		"over batch limit":     {`[{"jsonrpc":"2.0","method":"a","params":[],"id":1},{"jsonrpc":"2.0","method":"a","params":[],"id":2},{"jsonrpc":"2.0","method":"a","params":[],"id":3}]`, http.StatusOK},
+		"not accepted":         {`{"jsonrpc":"2.0","method":"b","params":[],"id":1}`, http.StatusOK},
+		"unknown method":       {`{"jsonrpc":"2.0","method":"c","id":1}`, http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body)))
+		if w.Code != tc.status {
+			t.Errorf("%s: got status %d, want %d: %s", name, w.Code, tc.status, w.Body)
+		}
+	}
+}
+
+// hexCodec is a stand-in for a binary codec: messages are hex encoded JSON.
+type hexCodec struct{}
+
+func (hexCodec) Decode(body []byte) ([]byte, error) {
+	return hex.DecodeString(string(body))
+}
+
+func (hexCodec) Encode(resp []byte) ([]byte, error) {
+	return []byte(hex.EncodeToString(resp)), nil
+}
+
+func TestCodecs(t *testing.T) {
+	s := New()
+	s.Codecs = map[string]Codec{"application/x-hex": hexCodec{}}
+	s.Register("a", rpc.Wrap(func(ctx context.Context, params *struct{}) (int, error) {
+		return 1, nil
+	}))
+	req := `{"jsonrpc":"2.0","method":"a","id":1}`
+	resp := `{"jsonrpc":"2.0","result":1,"id":1}` + "\n"
+	hexReq, hexResp := hex.EncodeToString([]byte(req)), hex.EncodeToString([]byte(resp))
+	for name, tc := range map[string]struct {
+		body, contentType, accept string
+		wantType, wantBody        string
+	}{
+		"hex both ways":       {hexReq, "application/x-hex", "application/x-hex", "application/x-hex", hexResp},
+		"hex in, json out":    {hexReq, "application/x-hex", "application/json", "application/json", resp},
+		"json in, hex out":    {req, "application/json", "text/html, application/x-hex;q=0.9", "application/x-hex", hexResp},
+		"json":                {req, "application/json", "", "application/json", resp},
+		"unsupported accept":  {req, "application/json", "application/cbor", "application/json", resp},
+		"undecodable request": {"zz", "application/x-hex", "", "application/json", ""},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+		r.Header.Set("Content-Type", tc.contentType)
+		r.Header.Set("Accept", tc.accept)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if got := w.Header().Get("Content-Type"); got != tc.wantType {
+			t.Errorf("%s: got Content-Type %s, want %s", name, got, tc.wantType)
+		}
+		if tc.wantBody == "" {
+			if !strings.Contains(w.Body.String(), `"code":-32700`) {
+				t.Errorf("%s: got %s, want a parse error", name, w.Body)
+			}
+		} else if w.Body.String() != tc.wantBody {
+			t.Errorf("%s: got %s, want %s", name, w.Body, tc.wantBody)
+		}
+	}
+}
+
+func TestServerSentEvents(t *testing.T) {
+	s := New()
+	s.Register("a", rpc.Wrap(func(ctx context.Context, params *[]int) ([]int, error) {
+		return *params, nil
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`[
+		{"jsonrpc":"2.0","method":"a","params":[1],"id":1},
+		{"jsonrpc":"2.0","method":"a","params":[2]},
+		{"jsonrpc":"2.0","method":"a","params":[3],"id":3}
+	]`))
+	r.Header.Set("Accept", "text/event-stream")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if got := w.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("got Content-Type %s", got)
+	}
+	if !w.Flushed {
+		t.Fatal("events not flushed")
+	}
+	events := strings.Split(strings.TrimSuffix(w.Body.String(), "\n\n"), "\n\n")
+	sort.Strings(events)
+	want := []string{
+		`data: {"jsonrpc":"2.0","result":[1],"id":1}`,
+		`data: {"jsonrpc":"2.0","result":[3],"id":3}`,
+	}
+	if strings.Join(events, "|") != strings.Join(want, "|") {
+		t.Fatalf("got events %q, want one per request", events)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	ready := false
+	s := New(rpc.WithReadiness(func() bool { return ready }))
+	s.ReadinessPath = "/ready"
+	s.Register("a", rpc.Wrap(func(ctx context.Context, params *struct{}) (int, error) {
+		return 1, nil
+	}))
+	probe := func() int {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return w.Code
+	}
+	call := func() string {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"jsonrpc":"2.0","method":"a","id":1}`)))
+		return w.Body.String()
+	}
+	if code := probe(); code != http.StatusServiceUnavailable {
+		t.Fatalf("not ready: probe got %d", code)
+	}
+	if got := call(); !strings.Contains(got, `"message":"Not ready"`) {
+		t.Fatalf("not ready: got %s", got)
+	}
+	ready = true
+	if code := probe(); code != http.StatusOK {
+		t.Fatalf("ready: probe got %d", code)
+	}
+	if got := call(); !strings.Contains(got, `"result":1`) {
+		t.Fatalf("ready: got %s", got)
+	}
+}
@@ -0,0 +1,98 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+)
+
+// Accepted is a result telling the client that the call was accepted and its
+// work goes on in the background. Handlers made with Wrap or RegisterMethod
+// can return it as their result; other handlers use AcceptedResult. Over
+// HTTP a request whose calls all return Accepted is answered with status 202;
+// other transports send it as a normal result.
+type Accepted struct {
+	TrackingID string `json:"tracking_id"`
+}
+
+// AcceptedResult returns the encoded Accepted result with trackingID, for
+// handlers that encode their results themselves.
+func AcceptedResult(ctx context.Context, trackingID string) (json.RawMessage, error) {
+	return encodeResult(ctx, Accepted{TrackingID: trackingID})
+}
+
+type (
+	acceptedKey     struct{}
+	acceptedCallKey struct{}
+)
+
+type acceptedTracker struct {
+	responses atomic.Int32
+	accepted  atomic.Int32
+}
+
+// TrackAccepted returns a context to handle a request in and a func that
+// reports, once the request was handled, whether all of its calls returned
+// Accepted, with no error response among them. Transports use it to answer
+// such requests differently, like the http package does with status 202.
+func TrackAccepted(ctx context.Context) (context.Context, func() bool) {
+	t := &acceptedTracker{}
+	return context.WithValue(ctx, acceptedKey{}, t), func() bool {
+		responses := t.responses.Load()
+		return responses > 0 && t.accepted.Load() == responses
+	}
+}
+
+// trackCall returns a context to handle a single call in, in which
+// encodeResult can note an Accepted result, if ctx is tracked.
+func trackCall(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(acceptedKey{}).(*acceptedTracker); !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, acceptedCallKey{}, new(atomic.Bool))
+}
+
+// countResponse counts a response to a request or batch member, handled in a
+// ctx from trackCall, for TrackAccepted. A nil resp (a notification) is not
+// counted; an error response counts as not accepted.
+func countResponse(ctx context.Context, resp *rpcResponse) {
+	t, ok := ctx.Value(acceptedKey{}).(*acceptedTracker)
+	if !ok || resp == nil {
+		return
+	}
+	t.responses.Add(1)
+	if accepted, ok := ctx.Value(acceptedCallKey{}).(*atomic.Bool); ok && accepted.Load() && resp.Error == nil {
+		t.accepted.Add(1)
+	}
+}
+
+// encodeResult marshals the result of a wrapped handler, noting Accepted
+// results for TrackAccepted.
+func encodeResult(ctx context.Context, result any) (json.RawMessage, error) {
+	switch result.(type) {
+	case Accepted, *Accepted:
+		if accepted, ok := ctx.Value(acceptedCallKey{}).(*atomic.Bool); ok {
+			accepted.Store(true)
+		}
+	}
+	return json.Marshal(result)
+}
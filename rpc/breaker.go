@@ -0,0 +1,135 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CircuitBreakerMiddleware fails calls to a method fast with
+// ErrCodeCircuitOpen after threshold consecutive failures of it, for
+// cooldown. Then one trial call is let through: if it succeeds the method is
+// closed again, otherwise it stays open for another cooldown. Errors caused
+// by the client (unknown method, invalid request or params) count neither as
+// failures nor as successes; every other error of the handler is a failure.
+func CircuitBreakerMiddleware(threshold int, cooldown time.Duration) Middleware {
+	cb := &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		methods:   map[string]*circuit{},
+	}
+	return func(next Handler) Handler {
+		return func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+			method := MethodFromContext(ctx)
+			if !cb.allow(method) {
+				return nil, NewError(ErrCodeCircuitOpen)
+			}
+			outcome := callFailed
+			// deferred, so that a panicking handler counts as failed
+			defer func() { cb.done(method, outcome) }()
+			result, err := next(ctx, params)
+			outcome = callOutcome(err)
+			return result, err
+		}
+	}
+}
+
+type outcome int
+
+const (
+	callSucceeded outcome = iota
+	callFailed
+	clientError
+)
+
+// callOutcome classifies the error of a call for the circuit breaker.
+func callOutcome(err error) outcome {
+	if err == nil {
+		return callSucceeded
+	}
+	var e Error
+	if errors.As(err, &e) {
+		switch e.Code {
+		case ErrCodeParseError, ErrCodeInvalidRequest, ErrCodeMethodNotFound, ErrCodeInvalidParams:
+			return clientError
+		}
+	}
+	return callFailed
+}
+
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	methods   map[string]*circuit
+	mu        sync.Mutex
+}
+
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func (cb *circuitBreaker) allow(method string) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c, ok := cb.methods[method]
+	if !ok || c.failures < cb.threshold {
+		return true
+	}
+	if c.probing || time.Now().Before(c.openUntil) {
+		return false
+	}
+	// half open: let one call through to test recovery
+	c.probing = true
+	return true
+}
+
+// done records the outcome of a call to method. Methods get an entry only
+// once they fail, so calls of unknown methods, which are client errors, never
+// add one.
+func (cb *circuitBreaker) done(method string, o outcome) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c, found := cb.methods[method]
+	if !found {
+		if o != callFailed {
+			return
+		}
+		c = &circuit{}
+		cb.methods[method] = c
+	}
+	c.probing = false
+	if o == clientError {
+		return
+	}
+	if o == callSucceeded {
+		c.failures = 0
+		return
+	}
+	c.failures++
+	if c.failures >= cb.threshold {
+		c.openUntil = time.Now().Add(cb.cooldown)
+	}
+}
@@ -0,0 +1,71 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	s := New(WithMiddleware(CircuitBreakerMiddleware(2, time.Minute)))
+	failing := false
+	s.Register("a", Wrap(func(ctx context.Context, params *[]int) (int, error) {
+		if failing {
+			return 0, errors.New("down")
+		}
+		return 1, nil
+	}))
+	call := func(params string) string {
+		return string(s.HandleBytes(context.Background(), []byte(`{"jsonrpc":"2.0","method":"a","params":`+params+`,"id":1}`)))
+	}
+	for i := 0; i < 3; i++ {
+		call(`{"not":"an array"}`)
+		s.HandleBytes(context.Background(), []byte(fmt.Sprintf(`{"jsonrpc":"2.0","method":"unknown%d","id":1}`, i)))
+	}
+	if resp := call(`[]`); !strings.Contains(resp, `"result":1`) {
+		t.Fatalf("client errors opened the circuit: %s", resp)
+	}
+	failing = true
+	call(`[]`)
+	call(`[]`)
+	if resp := call(`[]`); !strings.Contains(resp, fmt.Sprint(ErrCodeCircuitOpen)) {
+		t.Fatalf("expected open circuit, got %s", resp)
+	}
+}
+
+func TestCircuitBreakerNoEntriesForClientErrors(t *testing.T) {
+	cb := &circuitBreaker{threshold: 1, cooldown: time.Minute, methods: map[string]*circuit{}}
+	for i := 0; i < 100; i++ {
+		method := fmt.Sprintf("m%d", i)
+		if cb.allow(method) {
+			cb.done(method, callOutcome(ErrMethodNotFound))
+		}
+	}
+	if len(cb.methods) != 0 {
+		t.Fatalf("%d entries for unknown methods", len(cb.methods))
+	}
+}
+
+func TestCallOutcome(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want outcome
+	}{
+		{nil, callSucceeded},
+		{errors.New("down"), callFailed},
+		{NewError(ErrCodeInvalidParams), clientError},
+		{fmt.Errorf("wrapped: %w", ErrMethodNotFound), clientError},
+		{handlerError(NewError(ErrCodeInvalidParams)), clientError},
+		{handlerError(fmt.Errorf("wrapped: %w", ErrMethodNotFound)), clientError},
+		{handlerError(errors.New("down")), callFailed},
+		{json.Unmarshal([]byte("{"), new(any)), callFailed},
+	} {
+		if got := callOutcome(tc.err); got != tc.want {
+			t.Errorf("%v: got %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
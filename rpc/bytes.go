@@ -0,0 +1,35 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import "encoding/json"
+
+// BytesResult is a binary result. Returned from a wrapped handler it is sent
+// as a base64 encoded JSON string; use DecodeBytesResult to get it back.
+type BytesResult []byte
+
+// DecodeBytesResult decodes a result produced from a BytesResult.
+func DecodeBytesResult(raw json.RawMessage) ([]byte, error) {
+	var b BytesResult
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
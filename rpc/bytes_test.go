@@ -0,0 +1,29 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestBytesResultRoundTrip(t *testing.T) {
+	data := []byte{0, 1, 2, 0xfe, 0xff, '"', '\n'}
+	s := New()
+	s.Register("blob", Wrap(func(ctx context.Context, params *struct{}) (BytesResult, error) {
+		return data, nil
+	}))
+	var r struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(handle(s, `{"jsonrpc":"2.0","method":"blob","id":1}`)), &r); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeBytesResult(r.Result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("got %v, want %v", got, data)
+	}
+}
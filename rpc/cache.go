@@ -0,0 +1,116 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Cache stores results for CacheMiddleware.
+type Cache interface {
+	Get(key string) (json.RawMessage, bool)
+	Set(key string, value json.RawMessage, ttl time.Duration)
+}
+
+// CacheMiddleware returns results from cache for requests with the same key,
+// for ttl after the first successful call. Errors are never cached. keyFn
+// builds the key from the method and params; an empty key bypasses the cache.
+func CacheMiddleware(cache Cache, keyFn func(method string, params json.RawMessage) string, ttl time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+			key := keyFn(MethodFromContext(ctx), params)
+			if key == "" {
+				return next(ctx, params)
+			}
+			if result, ok := cache.Get(key); ok {
+				return result, nil
+			}
+			result, err := next(ctx, params)
+			if err != nil {
+				return nil, err
+			}
+			cache.Set(key, result, ttl)
+			return result, nil
+		}
+	}
+}
+
+// MemoryCache is an in-memory Cache. Expired entries are dropped on access,
+// and swept from time to time by Set, so that keys never read again don't
+// pile up.
+type MemoryCache struct {
+	items   map[string]cacheItem
+	sweepAt int // size at which Set sweeps next
+	mu      sync.Mutex
+}
+
+// minCacheSweep is the smallest size at which MemoryCache sweeps.
+const minCacheSweep = 64
+
+type cacheItem struct {
+	value   json.RawMessage
+	expires time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		items: map[string]cacheItem{},
+		mu:    sync.Mutex{},
+	}
+}
+
+func (c *MemoryCache) Get(key string) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(item.expires) {
+		delete(c.items, key)
+		return nil, false
+	}
+	return item.value, true
+}
+
+func (c *MemoryCache) Set(key string, value json.RawMessage, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.items) >= c.sweepAt {
+		// sweeping at twice the live size keeps Set amortized O(1)
+		for k, item := range c.items {
+			if now.After(item.expires) {
+				delete(c.items, k)
+			}
+		}
+		c.sweepAt = 2 * len(c.items)
+		if c.sweepAt < minCacheSweep {
+			c.sweepAt = minCacheSweep
+		}
+	}
+	c.items[key] = cacheItem{
+		value:   value,
+		expires: now.Add(ttl),
+	}
+}
@@ -0,0 +1,45 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheMiddleware(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	byMethod := func(method string, params json.RawMessage) string { return method }
+	s := New(WithMiddleware(CacheMiddleware(NewMemoryCache(), byMethod, ttl)))
+	calls := 0
+	s.Register("count", func(context.Context, json.RawMessage) (json.RawMessage, error) {
+		calls++
+		return json.RawMessage(fmt.Sprint(calls)), nil
+	})
+	req := `{"jsonrpc":"2.0","method":"count","id":1}`
+	for i := 0; i < 3; i++ {
+		if got := handle(s, req); !strings.Contains(got, `"result":1`) {
+			t.Fatalf("call %d: got %s", i, got)
+		}
+	}
+	time.Sleep(2 * ttl)
+	if got := handle(s, req); !strings.Contains(got, `"result":2`) {
+		t.Fatalf("after expiry: got %s", got)
+	}
+}
+
+func TestMemoryCacheSweeps(t *testing.T) {
+	c := NewMemoryCache()
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprint("old", i), json.RawMessage(`1`), time.Nanosecond)
+	}
+	time.Sleep(time.Millisecond)
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprint("new", i), json.RawMessage(`1`), time.Hour)
+	}
+	if n := len(c.items); n > 1000+minCacheSweep {
+		t.Fatalf("%d entries kept, expired ones not swept", n)
+	}
+}
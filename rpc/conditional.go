@@ -0,0 +1,55 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// IfVersionMiddleware implements optimistic locking: if the params of a call
+// have an "if_version" member, current is asked for the current version of
+// the target and the call fails with ErrCodeVersionConflict, before the
+// handler runs, if the two differ. A string if_version is compared by its
+// value, any other JSON value by its text. Calls without if_version pass.
+func IfVersionMiddleware(current func(ctx context.Context, params json.RawMessage) (string, error)) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+			raw, ok := ParamsField(params, "if_version")
+			if !ok {
+				return next(ctx, params)
+			}
+			want := string(raw)
+			var s string
+			if err := json.Unmarshal(raw, &s); err == nil {
+				want = s
+			}
+			have, err := current(ctx, params)
+			if err != nil {
+				return nil, err
+			}
+			if have != want {
+				LoggerFromContext(ctx).Logf("Version conflict: have %s, want %s", have, want)
+				return nil, NewError(ErrCodeVersionConflict)
+			}
+			return next(ctx, params)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestIfVersionMiddleware(t *testing.T) {
+	s := New(WithMiddleware(IfVersionMiddleware(func(ctx context.Context, params json.RawMessage) (string, error) {
+		return "7", nil
+	})))
+	s.Register("update", constHandler(`true`))
+	for params, want := range map[string]string{
+		`{"if_version":"7"}`: `"result":true`,
+		`{"if_version":7}`:   `"result":true`,
+		`{"if_version":"6"}`: fmt.Sprintf(`"code":%d`, ErrCodeVersionConflict),
+		`{"name":"x"}`:       `"result":true`,
+	} {
+		if got := handle(s, `{"jsonrpc":"2.0","method":"update","params":`+params+`,"id":1}`); !strings.Contains(got, want) {
+			t.Errorf("%s: got %s, want %s", params, got, want)
+		}
+	}
+}
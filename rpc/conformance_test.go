@@ -0,0 +1,19 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+
+	"go.neonxp.dev/jsonrpc2/rpc"
+	"go.neonxp.dev/jsonrpc2/rpctest"
+)
+
+func TestConformance(t *testing.T) {
+	s := rpc.New()
+	rpctest.RegisterSpecMethods(s)
+	rpctest.ConformanceTest(t, func(b []byte) []byte {
+		resp := s.HandleBytes(context.Background(), b)
+		rpctest.AssertValidResponse(t, resp)
+		return resp
+	})
+}
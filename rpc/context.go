@@ -0,0 +1,158 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+type (
+	loggerKey        struct{}
+	methodKey        struct{}
+	enrichedKey      struct{}
+	remoteAddrKey    struct{}
+	batchIDKey       struct{}
+	paramsKey        struct{}
+	correlationIDKey struct{}
+)
+
+// MethodFromContext returns the method of the request handled in ctx, or an
+// empty string outside of a request.
+func MethodFromContext(ctx context.Context) string {
+	method, _ := ctx.Value(methodKey{}).(string)
+	return method
+}
+
+// ParamsPresent reports whether the request handled in ctx has a params
+// member, even if it is null. Wrapped handlers get the zero value (after
+// Defaults) both for null and for omitted params; where the two differ, e.g.
+// null meaning "clear" in a patch method, check ParamsPresent.
+func ParamsPresent(ctx context.Context) bool {
+	present, _ := ctx.Value(paramsKey{}).(bool)
+	return present
+}
+
+// CorrelationIDFromContext returns the correlation id of the request handled
+// in ctx, see WithCorrelationID, or an empty string.
+func CorrelationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// LoggerFromContext returns the logger for the request handled in ctx. Every
+// line it writes goes to the server Logger prefixed with the request method
+// and id. Outside of a request it returns a logger that discards everything.
+func LoggerFromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return l
+	}
+	return nopLogger{}
+}
+
+// RemoteAddrFromContext returns the remote address of the connection the
+// request came in on, for connections accepted by ListenAndServe. It is empty
+// for other transports.
+func RemoteAddrFromContext(ctx context.Context) string {
+	addr, _ := ctx.Value(remoteAddrKey{}).(string)
+	return addr
+}
+
+func withRemoteAddr(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, remoteAddrKey{}, addr)
+}
+
+// log returns the server Logger, prefixed with the remote address and the
+// correlation id if ctx has them. A panic in the Logger is recovered, see
+// safeLogger.
+func (r *RpcServer) log(ctx context.Context) Logger {
+	var l Logger = safeLogger{base: r.Logger}
+	if id := CorrelationIDFromContext(ctx); id != "" {
+		l = prefixLogger{base: l, prefix: fmt.Sprintf("[correlation=%s] ", id)}
+	}
+	if addr := RemoteAddrFromContext(ctx); addr != "" {
+		l = prefixLogger{base: l, prefix: fmt.Sprintf("[remote=%s] ", addr)}
+	}
+	return l
+}
+
+// Log returns the server Logger as used for the request handled in ctx, for
+// transports to log through. Like every server log line, a panic in the
+// Logger is recovered.
+func (r *RpcServer) Log(ctx context.Context) Logger {
+	return r.log(ctx)
+}
+
+// enrich applies the ContextEnricher to ctx, once: a context that was already
+// enriched, e.g. by Serve for the connection, is returned as is.
+func (r *RpcServer) enrich(ctx context.Context) context.Context {
+	if r.ContextEnricher == nil || ctx.Value(enrichedKey{}) != nil {
+		return ctx
+	}
+	return context.WithValue(r.ContextEnricher(ctx), enrichedKey{}, true)
+}
+
+// BatchIDFromContext returns the id the server generated for the batch the
+// request is part of, or an empty string for single requests.
+func BatchIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(batchIDKey{}).(string)
+	return id
+}
+
+func withBatchID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, batchIDKey{}, id)
+}
+
+// newID returns an id for the server's own use, e.g. a batch id, from the
+// generator set with WithIDGenerator or 16 random hex digits.
+func (r *RpcServer) newID() string {
+	if r.idGenerator != nil {
+		return r.idGenerator()
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func withRequest(ctx context.Context, base Logger, req *rpcRequest) context.Context {
+	ctx = context.WithValue(ctx, methodKey{}, req.Method)
+	ctx = context.WithValue(ctx, paramsKey{}, req.Params != nil)
+	prefix := fmt.Sprintf("[%s id=%s] ", req.Method, req.Id)
+	if batch := BatchIDFromContext(ctx); batch != "" {
+		prefix = fmt.Sprintf("[%s id=%s batch=%s] ", req.Method, req.Id, batch)
+	}
+	return context.WithValue(ctx, loggerKey{}, prefixLogger{
+		base:   base,
+		prefix: prefix,
+	})
+}
+
+type prefixLogger struct {
+	base   Logger
+	prefix string
+}
+
+// Logf passes the prefix as an argument, as it holds client data (method,
+// id) that must not be taken for formatting directives.
+func (p prefixLogger) Logf(format string, args ...interface{}) {
+	p.base.Logf("%s"+format, append([]interface{}{p.prefix}, args...)...)
+}
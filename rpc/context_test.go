@@ -0,0 +1,99 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordLogger) Logf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestRequestLoggerPrefixNotFormatted(t *testing.T) {
+	logger := &recordLogger{}
+	s := New(WithCorrelationID(func(ctx context.Context, params json.RawMessage) string {
+		return "%v"
+	}))
+	s.Logger = logger
+	s.MethodRewriter = func(string) string { return "log" }
+	s.Register("log", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		LoggerFromContext(ctx).Logf("hello %s", "world")
+		return nil, nil
+	})
+	s.HandleBytes(context.Background(), []byte(`{"jsonrpc":"2.0","method":"%d%s","id":"%x"}`))
+	want := `[correlation=%v] [%d%s id="%x"] hello world`
+	if len(logger.lines) != 1 || logger.lines[0] != want {
+		t.Fatalf("got %q, want %q", logger.lines, want)
+	}
+}
+
+func TestBatchID(t *testing.T) {
+	s := New()
+	s.Register("id", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		return json.Marshal(BatchIDFromContext(ctx))
+	})
+	batchIDs := func() []string {
+		var resp []struct {
+			Result string `json:"result"`
+		}
+		if err := json.Unmarshal([]byte(handle(s, `[{"jsonrpc":"2.0","method":"id","id":1},{"jsonrpc":"2.0","method":"id","id":2}]`)), &resp); err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]string, len(resp))
+		for i, r := range resp {
+			ids[i] = r.Result
+		}
+		return ids
+	}
+	first, second := batchIDs(), batchIDs()
+	if len(first) != 2 || first[0] == "" || first[0] != first[1] {
+		t.Fatalf("got batch ids %q, want one shared id", first)
+	}
+	if second[0] != second[1] || second[0] == first[0] {
+		t.Fatalf("got batch ids %q and %q, want a new id per batch", first, second)
+	}
+	if got := handle(s, `{"jsonrpc":"2.0","method":"id","id":1}`); !strings.Contains(got, `"result":""`) {
+		t.Fatalf("single request: got %s, want no batch id", got)
+	}
+}
+
+func TestParamsPresent(t *testing.T) {
+	s := New()
+	s.Register("patch", Wrap(func(ctx context.Context, p *struct{ Name string }) (bool, error) {
+		return ParamsPresent(ctx), nil
+	}))
+	for params, want := range map[string]string{
+		`,"params":null`:         `"result":true`,
+		`,"params":{"Name":"x"}`: `"result":true`,
+		``:                       `"result":false`,
+	} {
+		if got := handle(s, `{"jsonrpc":"2.0","method":"patch"`+params+`,"id":1}`); !strings.Contains(got, want) {
+			t.Errorf("%q: got %s, want %s", params, got, want)
+		}
+	}
+}
+
+func TestCorrelationIDInResponse(t *testing.T) {
+	s := New(WithCorrelationID(func(ctx context.Context, params json.RawMessage) string {
+		id, _ := ParamsToken(params, "trace")
+		return id
+	}))
+	s.Register("a", constHandler(`1`))
+	if got, want := handle(s, `{"jsonrpc":"2.0","method":"a","params":{"trace":"t-1"},"id":1}`), `{"jsonrpc":"2.0","result":1,"id":1,"correlation_id":"t-1"}`+"\n"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if got := handle(s, `{"jsonrpc":"2.0","method":"a","params":{},"id":1}`); strings.Contains(got, "correlation_id") {
+		t.Fatalf("got %s, want no correlation id", got)
+	}
+}
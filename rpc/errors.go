@@ -19,15 +19,26 @@
 
 package rpc
 
-import "fmt"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
 
 const (
-	ErrCodeParseError     = -32700
-	ErrCodeInvalidRequest = -32600
-	ErrCodeMethodNotFound = -32601
-	ErrCodeInvalidParams  = -32602
-	ErrCodeInternalError  = -32603
-	ErrUser               = -32000
+	ErrCodeParseError      = -32700
+	ErrCodeInvalidRequest  = -32600
+	ErrCodeMethodNotFound  = -32601
+	ErrCodeInvalidParams   = -32602
+	ErrCodeInternalError   = -32603
+	ErrUser                = -32000
+	ErrCodeTimeout         = -32001
+	ErrCodeServerBusy      = -32002
+	ErrCodeRedirect        = -32003 // call another server, see NewRedirectError
+	ErrCodeVersionConflict = -32004 // stale if_version, see IfVersionMiddleware
+	ErrCodeUnavailable     = -32005
+	ErrCodeBatchLimit      = -32006 // see RpcServer.MaxPerBatch
+	ErrCodeCircuitOpen     = -32007 // see CircuitBreakerMiddleware
 )
 
 var errorMap = map[int]string{
@@ -37,19 +48,102 @@ var errorMap = map[int]string{
 	-32602: "Invalid params",   // Invalid method parameter(s).
 	-32603: "Internal error",   // Internal JSON-RPC error.
 	-32000: "Other error",
+	-32001: "Request timeout",
+	-32002: "Server busy",
+	-32003: "Moved",
+	-32004: "Version conflict",
+	-32005: "Temporarily unavailable",
+	-32006: "Batch limit exceeded",
+	-32007: "Circuit open",
+}
+
+// InternalFailure tells apart the causes of an Internal error response.
+type InternalFailure int
+
+const (
+	// InternalMarshal means the response could not be marshaled.
+	InternalMarshal InternalFailure = iota
+	// InternalWrite means the response could not be written.
+	InternalWrite
+	// InternalEncode means the method's ResultEncoder failed.
+	InternalEncode
+	// InternalPanic means the handler, or a hook handling the request, panicked.
+	InternalPanic
+	// InternalTooLarge means the result exceeded MaxResponseBytes.
+	InternalTooLarge
+	// InternalNilResult means the handler returned neither a result nor an
+	// error, see WithNilResultError.
+	InternalNilResult
+)
+
+var internalMessages = map[InternalFailure]string{
+	InternalMarshal:   "Internal error: can't marshal response",
+	InternalWrite:     "Internal error: can't write response",
+	InternalEncode:    "Internal error: can't encode result",
+	InternalPanic:     "Internal error: handler panicked",
+	InternalTooLarge:  "Internal error: response too large",
+	InternalNilResult: "Internal error: no result",
 }
 
 //-32000 to -32099 	RpcServer error 	Reserved for implementation-defined server-errors.
 
+// ErrMethodNotFound is returned by the handler chain for methods that are not
+// registered. Middlewares may catch it and handle the call themselves.
+var ErrMethodNotFound = NewError(ErrCodeMethodNotFound)
+
 type Error struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+
+	cause error // the handler error this was made from, see userError
 }
 
 func (e Error) Error() string {
 	return fmt.Sprintf("jsonrpc2 error: code: %d message: %s", e.Code, e.Message)
 }
 
+// Unwrap returns the handler error e was made from, if any, e.g. the error a
+// handler made with Wrap returned.
+func (e Error) Unwrap() error {
+	return e.cause
+}
+
+// userError returns the Error sent for a handler error err that is not an
+// Error itself: an ErrUser error with the message of err, still wrapping err
+// for ErrorMapper and ErrorTransformer.
+func userError(err error) Error {
+	return Error{Code: ErrUser, Message: err.Error(), cause: err}
+}
+
+// toError returns err as sent to the client: the Error it is or wraps, or
+// else a userError.
+func toError(err error) Error {
+	var e Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return userError(err)
+}
+
+// handlerError returns the error of a handler made with Wrap or
+// RegisterMethod as passed on: unchanged if it is or wraps an Error, so that
+// e.g. a redirect keeps its code and data, or else a userError.
+func handlerError(err error) error {
+	var e Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return userError(err)
+}
+
+// mappable reports whether err is for the ErrorMapper: not an Error, or one
+// made by userError, like the plain errors of handlers made with Wrap.
+func mappable(err error) bool {
+	var e Error
+	return !errors.As(err, &e) || e.cause != nil
+}
+
 func NewError(code int) Error {
 	if _, ok := errorMap[code]; ok {
 		return Error{
@@ -59,3 +153,84 @@ func NewError(code int) Error {
 	}
 	return Error{Code: code}
 }
+
+// ErrorBuilder builds an Error fluently, e.g.
+//
+//	return nil, rpc.Err(rpc.ErrCodeInvalidParams).Message("bad range").Data(r)
+//
+// It is an error itself, sent with the same wire shape as the Error it
+// wraps, so handlers may return it directly.
+type ErrorBuilder struct {
+	err Error
+}
+
+// Err starts an ErrorBuilder for code, with the standard message of code if
+// there is one.
+func Err(code int) ErrorBuilder {
+	return ErrorBuilder{err: NewError(code)}
+}
+
+// Message sets the error message.
+func (b ErrorBuilder) Message(msg string) ErrorBuilder {
+	b.err.Message = msg
+	return b
+}
+
+// Data sets the error data.
+func (b ErrorBuilder) Data(data any) ErrorBuilder {
+	b.err.Data = data
+	return b
+}
+
+func (b ErrorBuilder) Error() string {
+	return b.err.Error()
+}
+
+// Unwrap returns the built Error.
+func (b ErrorBuilder) Unwrap() error {
+	return b.err
+}
+
+func (b ErrorBuilder) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.err)
+}
+
+// Retryable is implemented by errors that may go away if the call is repeated,
+// see WithHandlerRetry.
+type Retryable interface {
+	Retryable() bool
+}
+
+// RedirectData is the data of a redirect error.
+type RedirectData struct {
+	// Target is where the client should send the call instead, e.g. a URL.
+	Target string `json:"target"`
+}
+
+// NewRedirectError returns an ErrCodeRedirect error telling the client to
+// send the call to target, e.g. the server of the right shard. target is sent
+// in the error data as RedirectData.
+func NewRedirectError(target string) error {
+	e := NewError(ErrCodeRedirect)
+	e.Data = RedirectData{Target: target}
+	return e
+}
+
+// withErrorChain returns err as an Error with the messages of err and of every
+// error it wraps as data. Errors that are not an Error become ErrUser errors.
+func withErrorChain(err, cause error) Error {
+	e := toError(err)
+	if u, ok := cause.(Error); ok && u.cause != nil {
+		// start at the handler error, not at its userError
+		cause = u.cause
+	}
+	var chain []string
+	for ; cause != nil; cause = errors.Unwrap(cause) {
+		// wrappers like ErrorBuilder repeat the message of what they wrap
+		if msg := cause.Error(); len(chain) == 0 || chain[len(chain)-1] != msg {
+			chain = append(chain, msg)
+		}
+	}
+	e.Data = chain
+	return e
+}
@@ -0,0 +1,110 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.neonxp.dev/jsonrpc2/rpc"
+	"go.neonxp.dev/jsonrpc2/rpctest"
+)
+
+type quotaError struct {
+	Limit int
+}
+
+func (e quotaError) Error() string {
+	return "quota exceeded"
+}
+
+func call(t *testing.T, s *rpc.RpcServer, method string) string {
+	t.Helper()
+	resp := s.HandleBytes(context.Background(), []byte(`{"jsonrpc":"2.0","method":"`+method+`","params":{},"id":1}`))
+	rpctest.AssertValidResponse(t, resp)
+	var r struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(resp, &r); err != nil {
+		t.Fatal(err)
+	}
+	return string(r.Error)
+}
+
+func errorServer() *rpc.RpcServer {
+	s := rpc.New()
+	s.Register("plain", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("boom")
+	})
+	s.Register("custom", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		return nil, quotaError{Limit: 3}
+	})
+	s.Register("wrapped", rpc.Wrap(func(ctx context.Context, params *struct{}) (int, error) {
+		return 0, quotaError{Limit: 5}
+	}))
+	s.Register("rpc", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		return nil, rpc.Err(rpc.ErrCodeInvalidParams).Message("bad").Data(1)
+	})
+	s.Register("wrappedRpc", rpc.Wrap(func(ctx context.Context, params *struct{}) (int, error) {
+		return 0, rpc.Err(rpc.ErrCodeInvalidParams).Message("bad range").Data(2)
+	}))
+	return s
+}
+
+func TestHandlerErrorsNormalized(t *testing.T) {
+	s := errorServer()
+	for method, want := range map[string]string{
+		"plain":   `{"code":-32000,"message":"boom"}`,
+		"custom":  `{"code":-32000,"message":"quota exceeded"}`,
+		"wrapped": `{"code":-32000,"message":"quota exceeded"}`,
+		"rpc":     `{"code":-32602,"message":"bad","data":1}`,
+
+		"wrappedRpc": `{"code":-32602,"message":"bad range","data":2}`,
+	} {
+		if got := call(t, s, method); got != want {
+			t.Errorf("%s: got %s, want %s", method, got, want)
+		}
+	}
+}
+
+func TestErrorMapper(t *testing.T) {
+	s := errorServer()
+	s.ErrorMapper = func(err error) error {
+		var q quotaError
+		if errors.As(err, &q) {
+			return rpc.Err(-32050).Message("Quota").Data(q.Limit)
+		}
+		return nil
+	}
+	for method, want := range map[string]string{
+		"plain":   `{"code":-32000,"message":"boom"}`,
+		"custom":  `{"code":-32050,"message":"Quota","data":3}`,
+		"wrapped": `{"code":-32050,"message":"Quota","data":5}`,
+		"rpc":     `{"code":-32602,"message":"bad","data":1}`,
+	} {
+		if got := call(t, s, method); got != want {
+			t.Errorf("%s: got %s, want %s", method, got, want)
+		}
+	}
+}
+
+func TestWrapRedirect(t *testing.T) {
+	s := rpc.New()
+	s.Register("moved", rpc.Wrap(func(ctx context.Context, params *struct{}) (int, error) {
+		return 0, rpc.NewRedirectError("http://other")
+	}))
+	if got, want := call(t, s, "moved"), `{"code":-32003,"message":"Moved","data":{"target":"http://other"}}`; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestErrorChainData(t *testing.T) {
+	s := rpc.New(rpc.WithErrorChainData())
+	s.Register("chain", rpc.Wrap(func(ctx context.Context, params *struct{}) (int, error) {
+		return 0, fmt.Errorf("a: %w", fmt.Errorf("b: %w", errors.New("c")))
+	}))
+	if got, want := call(t, s, "chain"), `{"code":-32000,"message":"a: b: c","data":["a: b: c","b: c","c"]}`; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
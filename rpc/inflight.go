@@ -0,0 +1,67 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// InFlightInfo describes a call that is being handled, see InFlight.
+type InFlightInfo struct {
+	Method  string
+	Id      json.RawMessage // nil for notifications
+	Started time.Time
+	Elapsed time.Duration
+}
+
+// InFlight returns the calls being handled right now, oldest first.
+func (r *RpcServer) InFlight() []InFlightInfo {
+	now := time.Now()
+	r.inFlightMu.Lock()
+	calls := make([]InFlightInfo, 0, len(r.inFlight))
+	for _, call := range r.inFlight {
+		call.Elapsed = now.Sub(call.Started)
+		calls = append(calls, call)
+	}
+	r.inFlightMu.Unlock()
+	sort.Slice(calls, func(i, j int) bool {
+		return calls[i].Started.Before(calls[j].Started)
+	})
+	return calls
+}
+
+// track records req as in flight until the returned func is called.
+func (r *RpcServer) track(req *rpcRequest) func() {
+	r.inFlightMu.Lock()
+	defer r.inFlightMu.Unlock()
+	if r.inFlight == nil {
+		r.inFlight = map[uint64]InFlightInfo{}
+	}
+	r.inFlightSeq++
+	seq := r.inFlightSeq
+	r.inFlight[seq] = InFlightInfo{Method: req.Method, Id: req.Id, Started: time.Now()}
+	return func() {
+		r.inFlightMu.Lock()
+		defer r.inFlightMu.Unlock()
+		delete(r.inFlight, seq)
+	}
+}
@@ -0,0 +1,45 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+func TestInFlight(t *testing.T) {
+	s := New()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s.Register("slow", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		started <- struct{}{}
+		<-release
+		return params, nil
+	})
+	wg := sync.WaitGroup{}
+	for _, req := range []string{
+		`{"jsonrpc":"2.0","method":"slow","id":1}`,
+		`{"jsonrpc":"2.0","method":"slow","id":"b"}`,
+	} {
+		wg.Add(1)
+		go func(req string) {
+			defer wg.Done()
+			handle(s, req)
+		}(req)
+		<-started
+	}
+	calls := s.InFlight()
+	close(release)
+	wg.Wait()
+	if len(calls) != 2 || string(calls[0].Id) != `1` || string(calls[1].Id) != `"b"` {
+		t.Fatalf("got %+v, want both calls, oldest first", calls)
+	}
+	for _, c := range calls {
+		if c.Method != "slow" || c.Elapsed <= 0 {
+			t.Errorf("unexpected call %+v", c)
+		}
+	}
+	if calls := s.InFlight(); len(calls) != 0 {
+		t.Fatalf("%d calls in flight after they returned", len(calls))
+	}
+}
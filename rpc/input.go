@@ -0,0 +1,138 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+var bom = []byte{0xEF, 0xBB, 0xBF}
+
+// Handle reads a single request or a batch from reader and writes the
+// response to writer. A leading UTF-8 byte order mark and whitespace are
+// skipped; anything else that is not JSON is answered with a Parse error.
+func (r *RpcServer) Handle(ctx context.Context, reader io.Reader, writer io.Writer) {
+	br := bufio.NewReader(reader)
+	first, err := peekFirst(br)
+	if err != nil {
+		r.log(ctx).Logf("Can't read body: %v", err)
+		r.WriteError(ErrCodeParseError, writer)
+		return
+	}
+	if first == '[' {
+		r.BatchRequest(ctx, br, writer)
+		return
+	}
+	r.SingleRequest(ctx, br, writer)
+}
+
+// peekFirst skips a byte order mark and leading whitespace in br and returns
+// the next byte without consuming it.
+func peekFirst(br *bufio.Reader) (byte, error) {
+	if err := skipBOM(br); err != nil {
+		return 0, err
+	}
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = br.ReadByte()
+		default:
+			return b[0], nil
+		}
+	}
+}
+
+func skipBOM(br *bufio.Reader) error {
+	b, err := br.Peek(len(bom))
+	if err == nil && bytes.Equal(b, bom) {
+		_, err = br.Discard(len(bom))
+		return err
+	}
+	if err == io.EOF && len(b) > 0 {
+		// shorter than a byte order mark
+		return nil
+	}
+	return err
+}
+
+func trimBOM(raw []byte) []byte {
+	return bytes.TrimPrefix(raw, bom)
+}
+
+// splitBatch splits a batch into its members without decoding them, so that a
+// malformed member does not fail the whole batch; it gets an Invalid Request
+// response of its own. Only a batch whose brackets, braces and strings are not
+// balanced is an error. Data after the closing bracket is ignored.
+func splitBatch(data []byte) ([]json.RawMessage, error) {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	if len(data) == 0 || data[0] != '[' {
+		return nil, errors.New("batch must be an array")
+	}
+	var batch []json.RawMessage
+	depth, start := 0, 1
+	inString, escaped := false, false
+	for i, c := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if c != ']' {
+				return nil, errors.New("unbalanced batch")
+			}
+			member := bytes.TrimSpace(data[start:i])
+			if len(member) > 0 || len(batch) > 0 {
+				batch = append(batch, member)
+			}
+			return batch, nil
+		case ',':
+			if depth == 1 {
+				batch = append(batch, bytes.TrimSpace(data[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return nil, errors.New("unterminated batch")
+}
@@ -0,0 +1,42 @@
+package rpc
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestByteOrderMark(t *testing.T) {
+	s := fuzzServer()
+	req := `{"jsonrpc":"2.0","method":"sum","params":[1,2],"id":1}`
+	want := `{"jsonrpc":"2.0","result":3,"id":1}` + "\n"
+	if got := handle(s, string(bom)+req); got != want {
+		t.Errorf("HandleBytes: got %s, want %s", got, want)
+	}
+	if got := serve(t, s, string(bom)+req); got != want {
+		t.Errorf("Serve: got %s, want %s", got, want)
+	}
+	if got := handle(s, string(bom)+"["+req+"]"); got != "["+strings.TrimSuffix(want, "\n")+"]\n" {
+		t.Errorf("batch: got %s", got)
+	}
+	for _, junk := range []string{"xx", string(bom) + string(bom), "\xef\xbb"} {
+		if got := handle(s, junk+req); !strings.Contains(got, `"code":-32700`) {
+			t.Errorf("%q prefix: got %s, want a parse error", junk, got)
+		}
+	}
+}
+
+func TestMalformedBatchMember(t *testing.T) {
+	s := fuzzServer()
+	var batch []map[string]any
+	resp := handle(s, `[{"jsonrpc":"2.0","method":"sum","params":[1],"id":1}, {"jsonrpc":"2.0","method":  , "id":2}, {"jsonrpc":"2.0","method":"sum","params":[2],"id":3}]`)
+	if err := json.Unmarshal([]byte(resp), &batch); err != nil || len(batch) != 3 {
+		t.Fatalf("got %s, %v, want three responses", resp, err)
+	}
+	for i, want := range []string{`"result":1`, `"code":-32600`, `"result":2`} {
+		b, _ := json.Marshal(batch[i])
+		if !strings.Contains(string(b), want) {
+			t.Errorf("member %d: got %s, want %s", i, b, want)
+		}
+	}
+}
@@ -19,7 +19,11 @@
 
 package rpc
 
-import "log"
+import (
+	"fmt"
+	"log"
+	"os"
+)
 
 type Logger interface {
 	Logf(format string, args ...interface{})
@@ -37,3 +41,18 @@ func (n stdLogger) Logf(format string, args ...interface{}) {
 }
 
 var StdLogger = stdLogger{}
+
+// safeLogger recovers from a panicking base Logger, so it can't take down
+// request processing, and writes the lost message to stderr instead.
+type safeLogger struct {
+	base Logger
+}
+
+func (s safeLogger) Logf(format string, args ...interface{}) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			fmt.Fprintf(os.Stderr, "jsonrpc2: logger panic: %v; message: %s\n", rec, fmt.Sprintf(format, args...))
+		}
+	}()
+	s.base.Logf(format, args...)
+}
@@ -0,0 +1,33 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type panicLogger struct{}
+
+func (panicLogger) Logf(string, ...interface{}) {
+	panic("logger broken")
+}
+
+func TestPanickingLogger(t *testing.T) {
+	s := New()
+	s.Logger = panicLogger{}
+	s.Register("fail", func(context.Context, json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("failed")
+	})
+	s.Register("log", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		LoggerFromContext(ctx).Logf("working")
+		return json.RawMessage(`1`), nil
+	})
+	if got := handle(s, `{"jsonrpc":"2.0","method":"fail","id":1}`); !strings.Contains(got, `"message":"failed"`) {
+		t.Fatalf("got %s, want the handler error", got)
+	}
+	if got := handle(s, `{"jsonrpc":"2.0","method":"log","id":1}`); !strings.Contains(got, `"result":1`) {
+		t.Fatalf("got %s, want the result", got)
+	}
+}
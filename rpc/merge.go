@@ -0,0 +1,55 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Merge combines the handlers of servers into a new server. The new server
+// takes its configuration (logger, options and exported fields) from the first
+// server; configuration of the others is ignored. If a method is registered
+// in more than one server the first registration wins and the collision is
+// reported in the returned error. The merged server is returned in both cases.
+func Merge(servers ...*RpcServer) (*RpcServer, error) {
+	if len(servers) == 0 {
+		return New(), nil
+	}
+	merged := servers[0].clone()
+	var collisions []string
+	for _, s := range servers {
+		s.mu.RLock()
+		for method, h := range s.handlers {
+			if _, ok := merged.handlers[method]; ok {
+				collisions = append(collisions, method)
+				continue
+			}
+			merged.handlers[method] = h
+		}
+		s.mu.RUnlock()
+	}
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return merged, fmt.Errorf("jsonrpc2: method collisions: %s", strings.Join(collisions, ", "))
+	}
+	return merged, nil
+}
@@ -0,0 +1,26 @@
+package rpc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	a, b := New(), New()
+	a.Register("a", constHandler(`"a"`))
+	a.Register("both", constHandler(`"first"`))
+	b.Register("b", constHandler(`"b"`))
+	b.Register("both", constHandler(`"second"`))
+	merged, err := Merge(a, b)
+	if err == nil || !strings.Contains(err.Error(), "both") {
+		t.Fatalf("got error %v, want the collision reported", err)
+	}
+	for method, want := range map[string]string{"a": `"a"`, "b": `"b"`, "both": `"first"`} {
+		if got := handle(merged, `{"jsonrpc":"2.0","method":"`+method+`","id":1}`); !strings.Contains(got, `"result":`+want) {
+			t.Errorf("%s: got %s, want result %s", method, got, want)
+		}
+	}
+	if _, err := Merge(New(), b); err != nil {
+		t.Fatalf("got error %v without collisions", err)
+	}
+}
@@ -0,0 +1,101 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Reflection based registration is the only use of package reflect in this
+// package besides encoding/json. Build with -tags jsonrpc2_noreflect to leave
+// it out; Register, Wrap and the rest of the server work the same without it.
+
+//go:build !jsonrpc2_noreflect
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// RegisterMethod registers fn as a handler for method. fn must have signature
+// func(context.Context, In) (Out, error), where In and Out are any json
+// serializable types (In may be a pointer). The signature is checked at
+// registration time and an error returned if it does not match.
+func (r *RpcServer) RegisterMethod(method string, fn any) error {
+	if err := r.validName(method); err != nil {
+		return err
+	}
+	h, err := reflectHandler(fn)
+	if err != nil {
+		return fmt.Errorf("jsonrpc2: can't register method %q: %w", method, err)
+	}
+	r.Register(method, h)
+	return nil
+}
+
+func reflectHandler(fn any) (Handler, error) {
+	v := reflect.ValueOf(fn)
+	if !v.IsValid() {
+		return nil, fmt.Errorf("expected func, got nil")
+	}
+	t := v.Type()
+	if t.Kind() != reflect.Func {
+		return nil, fmt.Errorf("expected func, got %s", t)
+	}
+	if t.IsVariadic() || t.NumIn() != 2 || t.NumOut() != 2 {
+		return nil, fmt.Errorf("expected func(context.Context, In) (Out, error), got %s", t)
+	}
+	if t.In(0) != contextType {
+		return nil, fmt.Errorf("first argument must be context.Context, got %s", t.In(0))
+	}
+	if t.Out(1) != errorType {
+		return nil, fmt.Errorf("second return value must be error, got %s", t.Out(1))
+	}
+	in := t.In(1)
+	return func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		req := newValue(in)
+		if d, ok := req.Interface().(Defaulter); ok {
+			d.Defaults()
+		}
+		if err := decodeParams(ctx, params, req.Interface()); err != nil {
+			return nil, err
+		}
+		if in.Kind() != reflect.Pointer {
+			req = req.Elem()
+		}
+		out := v.Call([]reflect.Value{reflect.ValueOf(ctx), req})
+		if err, _ := out[1].Interface().(error); err != nil {
+			return nil, handlerError(err)
+		}
+		return encodeResult(ctx, out[0].Interface())
+	}, nil
+}
+
+// newValue returns a pointer to a new zero value of t, or of its element type
+// if t is itself a pointer.
+func newValue(t reflect.Type) reflect.Value {
+	if t.Kind() == reflect.Pointer {
+		return reflect.New(t.Elem())
+	}
+	return reflect.New(t)
+}
@@ -0,0 +1,40 @@
+//go:build !jsonrpc2_noreflect
+
+package rpc
+
+import (
+	"context"
+	"testing"
+)
+
+type sumArgs struct {
+	A, B int
+}
+
+func TestRegisterMethod(t *testing.T) {
+	s := New()
+	if err := s.RegisterMethod("sum", func(ctx context.Context, args sumArgs) (int, error) {
+		return args.A + args.B, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for name, fn := range map[string]any{
+		"nil":        nil,
+		"not a func": 1,
+		"arity":      func(ctx context.Context) (int, error) { return 0, nil },
+		"no context": func(args sumArgs, extra int) (int, error) { return 0, nil },
+		"no error":   func(ctx context.Context, args sumArgs) (int, bool) { return 0, false },
+		"variadic":   func(ctx context.Context, args ...sumArgs) (int, error) { return 0, nil },
+	} {
+		if err := s.RegisterMethod("bad", fn); err == nil {
+			t.Errorf("%s: expected an error for a bad signature", name)
+		}
+	}
+	if _, ok := s.Methods()["bad"]; ok {
+		t.Fatal("bad signature registered")
+	}
+	got := string(s.HandleBytes(context.Background(), []byte(`{"jsonrpc":"2.0","method":"sum","params":{"A":1,"B":2},"id":1}`)))
+	if want := `{"jsonrpc":"2.0","result":3,"id":1}` + "\n"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
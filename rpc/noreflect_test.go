@@ -0,0 +1,33 @@
+//go:build jsonrpc2_noreflect
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// Run with -tags jsonrpc2_noreflect: the core dispatch path works without
+// the reflection based registration compiled in.
+func TestDispatchWithoutReflection(t *testing.T) {
+	s := New()
+	s.Register("raw", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		return params, nil
+	})
+	s.Register("sum", Wrap(func(ctx context.Context, params *[]int) (int, error) {
+		sum := 0
+		for _, n := range *params {
+			sum += n
+		}
+		return sum, nil
+	}))
+	for req, want := range map[string]string{
+		`{"jsonrpc":"2.0","method":"raw","params":[1],"id":1}`:   `{"jsonrpc":"2.0","result":[1],"id":1}`,
+		`{"jsonrpc":"2.0","method":"sum","params":[1,2],"id":2}`: `{"jsonrpc":"2.0","result":3,"id":2}`,
+	} {
+		if got := string(s.HandleBytes(context.Background(), []byte(req))); got != want+"\n" {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type Option func(r *RpcServer)
+
+// WithClientTimeouts lets clients bound a call by sending a numeric
+// "timeout_ms" member in the request. Values are capped by max.
+func WithClientTimeouts(max time.Duration) Option {
+	return func(r *RpcServer) {
+		r.clientTimeoutMax = max
+	}
+}
+
+// WithOmitVersionOnResponse drops the "jsonrpc" member from responses to save
+// bytes on constrained links. This is not spec compliant and is off by default.
+func WithOmitVersionOnResponse() Option {
+	return func(r *RpcServer) {
+		r.omitVersion = true
+	}
+}
+
+// WithStrictParams makes wrapped handlers (Wrap, RegisterMethod) reject params
+// with unknown fields with Invalid params instead of ignoring them.
+func WithStrictParams() Option {
+	return func(r *RpcServer) {
+		r.strictParams = true
+	}
+}
+
+// WithBatchResponseOrder sets whether batch responses follow the order of the
+// batch requests (the default) or the order in which the calls completed.
+// The spec allows both, clients must match responses by id.
+func WithBatchResponseOrder(ordered bool) Option {
+	return func(r *RpcServer) {
+		r.unorderedBatch = !ordered
+	}
+}
+
+// WithMiddleware wraps all handlers with mw. The first middleware is the
+// outermost one.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(r *RpcServer) {
+		r.middlewares = append(r.middlewares, mw...)
+	}
+}
+
+// WithNotificationAudit calls audit for every failed notification while
+// IgnoreNotifications is set. resp is the error response the notification
+// would have produced, with a null id. It is never written to the client.
+func WithNotificationAudit(audit func(method string, resp []byte)) Option {
+	return func(r *RpcServer) {
+		r.notificationAudit = audit
+	}
+}
+
+// WithNDJSON makes Serve write every response and batch response as exactly
+// one line of compact JSON terminated by a newline (newline delimited JSON).
+func WithNDJSON() Option {
+	return func(r *RpcServer) {
+		r.ndjson = true
+	}
+}
+
+// WithProtocolVersion sets the protocol version spoken by the server. "1.0"
+// accepts requests without the "jsonrpc" member and answers in the JSON-RPC
+// 1.0 shape: no "jsonrpc" member, both "result" and "error" present, one of
+// them null. Requests with a null id are notifications, as in 1.0. Any other
+// value keeps the default, 2.0.
+func WithProtocolVersion(v string) Option {
+	return func(r *RpcServer) {
+		r.legacy = v == legacyVersion
+	}
+}
+
+// WithErrorChainData puts the messages of a handler error and of every error
+// it wraps into the data member of the error response. It is meant for
+// debugging, as it can leak internal details, and is off by default.
+func WithErrorChainData() Option {
+	return func(r *RpcServer) {
+		r.errorChainData = true
+	}
+}
+
+// WithRecorder writes every request or batch together with its response to w
+// as one line of JSON (a Record), for later use with Replay. Requests that
+// could not be decoded are not recorded.
+func WithRecorder(w io.Writer) Option {
+	return func(r *RpcServer) {
+		r.recorder = &recorder{w: w}
+	}
+}
+
+// WithRecordRedactor passes every record to redact before it is written by
+// WithRecorder, e.g. to remove sensitive fields.
+func WithRecordRedactor(redact func(rec Record) Record) Option {
+	return func(r *RpcServer) {
+		r.recordRedact = redact
+	}
+}
+
+// WithInternalErrorMessage sets the message of Internal error responses caused
+// by failure f.
+func WithInternalErrorMessage(f InternalFailure, msg string) Option {
+	return func(r *RpcServer) {
+		if r.internalMessages == nil {
+			r.internalMessages = map[InternalFailure]string{}
+		}
+		r.internalMessages[f] = msg
+	}
+}
+
+// WithMethodNameValidator checks every method name on registration with
+// validate, e.g. to enforce a naming policy. RegisterMethod returns the error;
+// Register and the other registration methods, which return no error, panic
+// with it, so that a bad name fails at startup.
+func WithMethodNameValidator(validate func(method string) error) Option {
+	return func(r *RpcServer) {
+		r.methodNameValidator = validate
+	}
+}
+
+// WithHandlerRetry calls a handler again, up to max times, while it fails with
+// an error that implements Retryable and reports true. backoff, if not nil,
+// returns the wait before retry attempt (starting at 1). Retries share the
+// call's context and timeout. Retryable is looked for in the whole error
+// chain, so handlers made with Wrap or RegisterMethod can ask for a retry too.
+func WithHandlerRetry(max int, backoff func(attempt int) time.Duration) Option {
+	return func(r *RpcServer) {
+		r.retryMax = max
+		r.retryBackoff = backoff
+	}
+}
+
+// WithIDGenerator sets the generator of the ids the server makes up itself,
+// such as batch ids (see BatchIDFromContext). By default they are random.
+func WithIDGenerator(gen func() string) Option {
+	return func(r *RpcServer) {
+		r.idGenerator = gen
+	}
+}
+
+// WithStrictParamsType rejects params that are not an array or an object,
+// e.g. a number, string or null, with Invalid params before the handler runs,
+// as the spec requires. Omitted params are still accepted.
+func WithStrictParamsType() Option {
+	return func(r *RpcServer) {
+		r.strictParamsType = true
+	}
+}
+
+// WithDeprecationWarnings logs every call of a method registered with
+// MethodMeta.Deprecated set.
+func WithDeprecationWarnings() Option {
+	return func(r *RpcServer) {
+		r.deprecationWarnings = true
+	}
+}
+
+// WithReadiness makes the server reply to all requests with a "Not ready"
+// ErrCodeUnavailable error while ready returns false, e.g. until caches are
+// warm. See also Ready.
+func WithReadiness(ready func() bool) Option {
+	return func(r *RpcServer) {
+		r.readiness = ready
+	}
+}
+
+// WithCorrelationID tags every request with the correlation id extract
+// returns for it, e.g. from a params member or, via ContextEnricher, from a
+// transport header. A non-empty id is available to handlers from
+// CorrelationIDFromContext, prefixes all log lines of the request and is
+// echoed in the "correlation_id" member of the response.
+func WithCorrelationID(extract func(ctx context.Context, params json.RawMessage) string) Option {
+	return func(r *RpcServer) {
+		r.correlationID = extract
+	}
+}
+
+// WithNilResultError answers successful calls without a result, nil or null,
+// with an InternalNilResult error instead of "result": null, for servers
+// whose methods must always return a value.
+func WithNilResultError() Option {
+	return func(r *RpcServer) {
+		r.nilResultError = true
+	}
+}
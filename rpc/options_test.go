@@ -0,0 +1,188 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type retryError struct{}
+
+func (retryError) Error() string   { return "try again" }
+func (retryError) Retryable() bool { return true }
+
+func TestHandlerRetry(t *testing.T) {
+	s := New(WithHandlerRetry(2, nil))
+	calls := 0
+	s.Register("flaky", Wrap(func(ctx context.Context, params *struct{}) (int, error) {
+		calls++
+		if calls <= 2 {
+			return 0, retryError{}
+		}
+		return calls, nil
+	}))
+	s.Register("broken", Wrap(func(ctx context.Context, params *struct{}) (int, error) {
+		calls++
+		return 0, errors.New("down")
+	}))
+	if got, want := handle(s, `{"jsonrpc":"2.0","method":"flaky","id":1}`), `{"jsonrpc":"2.0","result":3,"id":1}`+"\n"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	calls = 0
+	handle(s, `{"jsonrpc":"2.0","method":"broken","id":1}`)
+	if calls != 1 {
+		t.Fatalf("non retryable error called %d times", calls)
+	}
+}
+
+func TestClientTimeouts(t *testing.T) {
+	s := New(WithClientTimeouts(50 * time.Millisecond))
+	s.Register("slow", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	s.Register("deadline", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		dl, ok := ctx.Deadline()
+		if !ok {
+			return json.RawMessage(`0`), nil
+		}
+		return json.Marshal(time.Until(dl).Milliseconds())
+	})
+	start := time.Now()
+	if got := handle(s, `{"jsonrpc":"2.0","method":"slow","id":1,"timeout_ms":5}`); !strings.Contains(got, fmt.Sprint(ErrCodeTimeout)) {
+		t.Fatalf("got %s, want a timeout", got)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("short timeout took %v", d)
+	}
+	var left int64
+	decodeResult(t, handle(s, `{"jsonrpc":"2.0","method":"deadline","id":1,"timeout_ms":60000}`), &left)
+	if left <= 0 || left > 50 {
+		t.Fatalf("deadline in %dms, want capped at 50ms", left)
+	}
+}
+
+func TestOmitVersionOnResponse(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"a","id":1}`
+	s := New()
+	s.Register("a", constHandler(`1`))
+	if got := handle(s, req); !strings.Contains(got, `"jsonrpc":"2.0"`) {
+		t.Fatalf("default: got %s, want the version", got)
+	}
+	s = New(WithOmitVersionOnResponse())
+	s.Register("a", constHandler(`1`))
+	if got, want := handle(s, req), `{"result":1,"id":1}`+"\n"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestBatchResponseOrder(t *testing.T) {
+	batch := `[{"jsonrpc":"2.0","method":"slow","id":1},{"jsonrpc":"2.0","method":"fast","id":2}]`
+	for ordered, want := range map[bool]string{
+		true:  `[{"jsonrpc":"2.0","result":1,"id":1},{"jsonrpc":"2.0","result":2,"id":2}]` + "\n",
+		false: `[{"jsonrpc":"2.0","result":2,"id":2},{"jsonrpc":"2.0","result":1,"id":1}]` + "\n",
+	} {
+		s := New(WithBatchResponseOrder(ordered))
+		fastDone := make(chan struct{})
+		s.Register("slow", func(context.Context, json.RawMessage) (json.RawMessage, error) {
+			<-fastDone
+			time.Sleep(20 * time.Millisecond)
+			return json.RawMessage(`1`), nil
+		})
+		s.Register("fast", func(context.Context, json.RawMessage) (json.RawMessage, error) {
+			close(fastDone)
+			return json.RawMessage(`2`), nil
+		})
+		if got := handle(s, batch); got != want {
+			t.Errorf("ordered %v: got %s, want %s", ordered, got, want)
+		}
+	}
+}
+
+func TestNotificationAudit(t *testing.T) {
+	var audited []string
+	s := New(WithNotificationAudit(func(method string, resp []byte) {
+		audited = append(audited, method+" "+string(resp))
+	}))
+	s.Register("fail", func(context.Context, json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("failed")
+	})
+	s.Register("ok", constHandler(`1`))
+	out := new(strings.Builder)
+	s.SingleRequest(context.Background(), strings.NewReader(`{"jsonrpc":"2.0","method":"fail"}`), out)
+	s.SingleRequest(context.Background(), strings.NewReader(`{"jsonrpc":"2.0","method":"ok"}`), out)
+	if out.Len() != 0 {
+		t.Fatalf("wrote %q for notifications", out.String())
+	}
+	want := `fail {"jsonrpc":"2.0","error":{"code":-32000,"message":"failed"},"id":null}`
+	if len(audited) != 1 || audited[0] != want {
+		t.Fatalf("audited %q, want %q", audited, want)
+	}
+}
+
+func TestInternalErrorMessage(t *testing.T) {
+	s := New(
+		WithInternalErrorMessage(InternalMarshal, "bad result"),
+		WithInternalErrorMessage(InternalPanic, "crashed"),
+	)
+	s.Register("invalid", constHandler(`{not json`))
+	s.Register("panic", func(context.Context, json.RawMessage) (json.RawMessage, error) {
+		panic("boom")
+	})
+	for method, want := range map[string]string{
+		"invalid": `{"jsonrpc":"2.0","error":{"code":-32603,"message":"bad result"},"id":1}`,
+		"panic":   `{"jsonrpc":"2.0","error":{"code":-32603,"message":"crashed"},"id":1}`,
+	} {
+		if got := handle(s, `{"jsonrpc":"2.0","method":"`+method+`","id":1}`); got != want+"\n" {
+			t.Errorf("%s: got %s, want %s", method, got, want)
+		}
+	}
+}
+
+func TestMethodNameValidator(t *testing.T) {
+	s := New(WithMethodNameValidator(func(method string) error {
+		if strings.ToLower(method) != method {
+			return errors.New("must be lower case")
+		}
+		return nil
+	}))
+	s.Register("user.get", constHandler(`1`))
+	if got := handle(s, `{"jsonrpc":"2.0","method":"user.get","id":1}`); !strings.Contains(got, `"result":1`) {
+		t.Fatalf("conforming name: got %s", got)
+	}
+	if err := s.validName("User.Get"); err == nil || !strings.Contains(err.Error(), "must be lower case") {
+		t.Fatalf("got %v, want the validator error", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Register accepted a rejected name")
+		}
+		if _, ok := s.Methods()["User.Get"]; ok {
+			t.Fatal("rejected name registered")
+		}
+	}()
+	s.Register("User.Get", constHandler(`1`))
+}
+
+func TestNilResult(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"none","id":1}`
+	s := New()
+	s.Register("none", func(context.Context, json.RawMessage) (json.RawMessage, error) {
+		return nil, nil
+	})
+	if got, want := handle(s, req), `{"jsonrpc":"2.0","result":null,"id":1}`+"\n"; got != want {
+		t.Fatalf("default: got %s, want %s", got, want)
+	}
+	s = New(WithNilResultError())
+	s.Register("none", func(context.Context, json.RawMessage) (json.RawMessage, error) {
+		return nil, nil
+	})
+	want := `{"jsonrpc":"2.0","error":{"code":-32603,"message":"` + internalMessages[InternalNilResult] + `"},"id":1}` + "\n"
+	if got := handle(s, req); got != want {
+		t.Fatalf("WithNilResultError: got %s, want %s", got, want)
+	}
+}
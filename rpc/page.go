@@ -0,0 +1,91 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import "context"
+
+// Page is a page of a list result. NextCursor is empty on the last page.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// WrapPage is like Wrap for handlers returning a page of items and the cursor
+// of the next page. The result is sent as a Page.
+func WrapPage[RQ any, T any](handler func(context.Context, *RQ) ([]T, string, error)) Handler {
+	return Wrap(func(ctx context.Context, req *RQ) (Page[T], error) {
+		items, next, err := handler(ctx, req)
+		if err != nil {
+			return Page[T]{}, err
+		}
+		return Page[T]{Items: items, NextCursor: next}, nil
+	})
+}
+
+// PageIterator fetches the pages of a list one by one, following the cursors.
+// Use it like a bufio.Scanner:
+//
+//	it := rpc.NewPageIterator(call)
+//	for it.Next(ctx) {
+//		use(it.Items())
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type PageIterator[T any] struct {
+	call   func(ctx context.Context, cursor string) (Page[T], error)
+	cursor string
+	items  []T
+	done   bool
+	err    error
+}
+
+// NewPageIterator returns an iterator over the pages returned by call. call
+// fetches the page at cursor, which is empty for the first page, e.g. by
+// calling the list method with the cursor in its params.
+func NewPageIterator[T any](call func(ctx context.Context, cursor string) (Page[T], error)) *PageIterator[T] {
+	return &PageIterator[T]{call: call}
+}
+
+// Next fetches the next page. It returns false after the last page or on
+// error.
+func (it *PageIterator[T]) Next(ctx context.Context) bool {
+	if it.done {
+		return false
+	}
+	page, err := it.call(ctx, it.cursor)
+	if err != nil {
+		it.err, it.done, it.items = err, true, nil
+		return false
+	}
+	it.items, it.cursor = page.Items, page.NextCursor
+	it.done = page.NextCursor == ""
+	return true
+}
+
+// Items returns the items of the page fetched by the last Next.
+func (it *PageIterator[T]) Items() []T {
+	return it.items
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *PageIterator[T]) Err() error {
+	return it.err
+}
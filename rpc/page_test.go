@@ -0,0 +1,50 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestPaging(t *testing.T) {
+	data := []int{1, 2, 3, 4, 5, 6, 7}
+	s := New()
+	s.Register("list", WrapPage(func(ctx context.Context, p *struct{ Cursor string }) ([]int, string, error) {
+		start, _ := strconv.Atoi(p.Cursor)
+		end := start + 3
+		if end >= len(data) {
+			return data[start:], "", nil
+		}
+		return data[start:end], strconv.Itoa(end), nil
+	}))
+	pages := 0
+	it := NewPageIterator(func(ctx context.Context, cursor string) (Page[int], error) {
+		pages++
+		params, _ := json.Marshal(map[string]string{"Cursor": cursor})
+		var page Page[int]
+		decodeResult(t, handle(s, fmt.Sprintf(`{"jsonrpc":"2.0","method":"list","params":%s,"id":1}`, params)), &page)
+		return page, nil
+	})
+	var got []int
+	for it.Next(context.Background()) {
+		got = append(got, it.Items()...)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if pages != 3 || !reflect.DeepEqual(got, data) {
+		t.Fatalf("got %v in %d pages, want %v in 3", got, pages, data)
+	}
+}
+
+func TestPageIteratorError(t *testing.T) {
+	it := NewPageIterator(func(ctx context.Context, cursor string) (Page[int], error) {
+		return Page[int]{}, NewError(ErrCodeInternalError)
+	})
+	if it.Next(context.Background()) || it.Err() == nil {
+		t.Fatal("expected the call error to stop the iteration")
+	}
+}
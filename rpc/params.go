@@ -0,0 +1,151 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// ParamsField returns the raw value at a dot separated path inside params,
+// e.g. "auth.token". Only the objects along the path are decoded; params is
+// left untouched for the handler.
+func ParamsField(params json.RawMessage, path string) (json.RawMessage, bool) {
+	cur := params
+	for _, key := range strings.Split(path, ".") {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(cur, &obj); err != nil {
+			return nil, false
+		}
+		next, ok := obj[key]
+		if !ok {
+			return nil, false
+		}
+		cur = next
+	}
+	return cur, true
+}
+
+// ParamsToken returns a non-empty string token at path inside params (see
+// ParamsField), e.g. for authenticating transports without headers.
+func ParamsToken(params json.RawMessage, path string) (string, bool) {
+	raw, ok := ParamsField(params, path)
+	if !ok {
+		return "", false
+	}
+	var token string
+	if err := json.Unmarshal(raw, &token); err != nil || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// DecodeOneOf decodes raw into the first of targets (pointers) it fits, for
+// params with several accepted shapes, and returns its index. A target fits
+// if raw decodes into it without error and without unknown object fields.
+// Targets tried before the match may be partially filled. If no target fits
+// it returns -1 and an Invalid params error.
+func DecodeOneOf(raw json.RawMessage, targets ...any) (int, error) {
+	for i, target := range targets {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(target); err == nil {
+			return i, nil
+		}
+	}
+	return -1, NewError(ErrCodeInvalidParams)
+}
+
+// MaxDecompressedBytes caps the decompressed size of a field decoded by
+// DecodeCompressedField.
+var MaxDecompressedBytes int64 = 10 << 20
+
+// DecodeCompressedField decodes the string at field inside params (a path as
+// for ParamsField) as base64 encoded, gzip compressed JSON into v, for clients
+// that compress large nested values. A missing field, corrupt data or data
+// inflating beyond MaxDecompressedBytes give an Invalid params error.
+func DecodeCompressedField(params json.RawMessage, field string, v any) error {
+	raw, ok := ParamsField(params, field)
+	if !ok {
+		return NewError(ErrCodeInvalidParams)
+	}
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err != nil {
+		return NewError(ErrCodeInvalidParams)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return NewError(ErrCodeInvalidParams)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return NewError(ErrCodeInvalidParams)
+	}
+	decoded, err := io.ReadAll(io.LimitReader(zr, MaxDecompressedBytes+1))
+	if err != nil || int64(len(decoded)) > MaxDecompressedBytes {
+		return NewError(ErrCodeInvalidParams)
+	}
+	if err := json.Unmarshal(decoded, v); err != nil {
+		return NewError(ErrCodeInvalidParams)
+	}
+	return nil
+}
+
+// structuredParams reports whether params are omitted, an array or an object,
+// the only forms the spec allows.
+func structuredParams(params json.RawMessage) bool {
+	params = bytes.TrimLeft(params, " \t\r\n")
+	return len(params) == 0 || params[0] == '[' || params[0] == '{'
+}
+
+// paramsDepth returns the maximum nesting depth of objects and arrays in
+// params. It scans the bytes without decoding, so it is safe to call on
+// arbitrarily deep input.
+func paramsDepth(params json.RawMessage) int {
+	depth, max := 0, 0
+	inString, escaped := false, false
+	for _, c := range params {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+			if depth > max {
+				max = depth
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+	return max
+}
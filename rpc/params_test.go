@@ -0,0 +1,119 @@
+package rpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func compressedParams(t *testing.T, data []byte) json.RawMessage {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return json.RawMessage(fmt.Sprintf(`{"blob":{"z":%q}}`, base64.StdEncoding.EncodeToString(buf.Bytes())))
+}
+
+func TestDecodeCompressedField(t *testing.T) {
+	var v map[string]any
+	if err := DecodeCompressedField(compressedParams(t, []byte(`{"a":[1,{"b":"c"}]}`)), "blob.z", &v); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"a": []any{1.0, map[string]any{"b": "c"}}}
+	if !reflect.DeepEqual(v, want) {
+		t.Fatalf("got %v, want %v", v, want)
+	}
+}
+
+func TestDecodeCompressedFieldErrors(t *testing.T) {
+	for name, params := range map[string]json.RawMessage{
+		"missing":    json.RawMessage(`{}`),
+		"not base64": json.RawMessage(`{"blob":{"z":"%%"}}`),
+		"not gzip":   json.RawMessage(`{"blob":{"z":"aGVsbG8="}}`),
+		"not json":   compressedParams(t, []byte(`{`)),
+	} {
+		var v any
+		if err := DecodeCompressedField(params, "blob.z", &v); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestDecodeCompressedFieldLimit(t *testing.T) {
+	defer func(max int64) { MaxDecompressedBytes = max }(MaxDecompressedBytes)
+	MaxDecompressedBytes = 1 << 10
+	params := compressedParams(t, []byte(`"`+string(bytes.Repeat([]byte("a"), 1<<20))+`"`))
+	var v string
+	err := DecodeCompressedField(params, "blob.z", &v)
+	if e, ok := err.(Error); !ok || e.Code != ErrCodeInvalidParams {
+		t.Fatalf("got %v, want Invalid params", err)
+	}
+}
+
+func TestParamsTokenMiddleware(t *testing.T) {
+	auth := func(next Handler) Handler {
+		return func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+			if token, ok := ParamsToken(params, "auth.token"); !ok || token != "secret" {
+				return nil, Error{Code: -32050, Message: "Unauthorized"}
+			}
+			return next(ctx, params)
+		}
+	}
+	s := New(WithMiddleware(auth))
+	s.Register("a", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		return params, nil
+	})
+	for params, want := range map[string]string{
+		`{"auth":{"token":"secret"},"n":1}`: `"result":{"auth":{"token":"secret"},"n":1}`,
+		`{"auth":{"token":"wrong"}}`:        `"code":-32050`,
+		`{"auth":{"token":""}}`:             `"code":-32050`,
+		`{"n":1}`:                           `"code":-32050`,
+		`[1]`:                               `"code":-32050`,
+	} {
+		if got := handle(s, `{"jsonrpc":"2.0","method":"a","params":`+params+`,"id":1}`); !strings.Contains(got, want) {
+			t.Errorf("%s: got %s, want %s", params, got, want)
+		}
+	}
+}
+
+func TestDecodeOneOf(t *testing.T) {
+	type byID struct {
+		ID int `json:"id"`
+	}
+	type byName struct {
+		Name string `json:"name"`
+	}
+	for raw, want := range map[string]int{
+		`{"id":5}`:       0,
+		`{"name":"bob"}`: 1,
+		`["bob"]`:        2,
+		`{"email":"x"}`:  -1,
+		`42`:             -1,
+	} {
+		var (
+			id   byID
+			name byName
+			list []string
+		)
+		got, err := DecodeOneOf(json.RawMessage(raw), &id, &name, &list)
+		if got != want {
+			t.Errorf("%s: got target %d, want %d", raw, got, want)
+		}
+		if want == -1 {
+			if e, ok := err.(Error); !ok || e.Code != ErrCodeInvalidParams {
+				t.Errorf("%s: got error %v, want invalid params", raw, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Stage is one step of a Pipe. It gets the output of the previous stage (the
+// params for the first one) and returns its own output. If done is true or
+// err is not nil the pipe stops and responds with out or err.
+type Stage func(ctx context.Context, in json.RawMessage) (out json.RawMessage, done bool, err error)
+
+// Pipe builds a handler from stages run one after another, e.g. validate,
+// transform, the core handler and post-processing of its result. The output
+// of the last stage is the result.
+func Pipe(stages ...Stage) Handler {
+	return func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		out := params
+		for _, stage := range stages {
+			var done bool
+			var err error
+			if out, done, err = stage(ctx, out); err != nil || done {
+				return out, err
+			}
+		}
+		return out, nil
+	}
+}
+
+// HandlerStage runs h as a stage that never stops the pipe by itself, e.g. for
+// the core handler in the middle of a Pipe.
+func HandlerStage(h Handler) Stage {
+	return func(ctx context.Context, in json.RawMessage) (json.RawMessage, bool, error) {
+		out, err := h(ctx, in)
+		return out, false, err
+	}
+}
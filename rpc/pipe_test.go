@@ -0,0 +1,41 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPipe(t *testing.T) {
+	var ran []string
+	validate := func(ctx context.Context, in json.RawMessage) (json.RawMessage, bool, error) {
+		ran = append(ran, "validate")
+		switch string(in) {
+		case `[]`:
+			return nil, false, NewError(ErrCodeInvalidParams)
+		case `"cached"`:
+			return json.RawMessage(`"from cache"`), true, nil
+		}
+		return in, false, nil
+	}
+	core := HandlerStage(func(ctx context.Context, in json.RawMessage) (json.RawMessage, error) {
+		ran = append(ran, "core")
+		return json.RawMessage(`{"echo":` + string(in) + `}`), nil
+	})
+	s := New()
+	s.Register("p", Pipe(validate, core))
+	for params, tc := range map[string]struct{ want, ran string }{
+		`[1]`:      {`"result":{"echo":[1]}`, "validate core"},
+		`[]`:       {`"code":-32602`, "validate"},
+		`"cached"`: {`"result":"from cache"`, "validate"},
+	} {
+		ran = nil
+		if got := handle(s, `{"jsonrpc":"2.0","method":"p","params":`+params+`,"id":1}`); !strings.Contains(got, tc.want) {
+			t.Errorf("%s: got %s, want %s", params, got, tc.want)
+		}
+		if got := strings.Join(ran, " "); got != tc.ran {
+			t.Errorf("%s: ran %s, want %s", params, got, tc.ran)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// ProgressMethod is the method of the notifications sent by
+// ProgressReporter.Report.
+const ProgressMethod = "$/progress"
+
+type progressKey struct{}
+
+// ProgressReporter sends progress notifications for a long running call to
+// the client while the call is still running.
+type ProgressReporter struct {
+	r    *RpcServer
+	send func(msg []byte) error
+}
+
+// ProgressFromContext returns the progress reporter of the request handled in
+// ctx. Progress can only be pushed over Serve and ListenAndServe connections;
+// elsewhere the returned reporter discards all reports.
+func ProgressFromContext(ctx context.Context) *ProgressReporter {
+	if p, ok := ctx.Value(progressKey{}).(*ProgressReporter); ok {
+		return p
+	}
+	return &ProgressReporter{}
+}
+
+func (r *RpcServer) withProgress(ctx context.Context, send func(msg []byte) error) context.Context {
+	return context.WithValue(ctx, progressKey{}, &ProgressReporter{r: r, send: send})
+}
+
+// Report sends a ProgressMethod notification with token, percent and message
+// as params. token correlates the report with the call, e.g. the request id or
+// a token the client passed in params.
+func (p *ProgressReporter) Report(token any, percent int, message string) error {
+	if p.send == nil {
+		return nil
+	}
+	msg, err := json.Marshal(progressNotification{
+		Jsonrpc: p.r.notificationVersion(),
+		Method:  ProgressMethod,
+		Params: progressParams{
+			Token:   token,
+			Percent: percent,
+			Message: message,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return p.send(append(msg, '\n'))
+}
+
+type progressNotification struct {
+	Jsonrpc string         `json:"jsonrpc,omitempty"`
+	Method  string         `json:"method"`
+	Params  progressParams `json:"params"`
+}
+
+type progressParams struct {
+	Token   any    `json:"token"`
+	Percent int    `json:"percent"`
+	Message string `json:"message,omitempty"`
+}
+
+// notificationVersion is the jsonrpc member of notifications sent by the
+// server; like responses, 1.0 mode and WithOmitVersionOnResponse drop it.
+func (r *RpcServer) notificationVersion() string {
+	if v := r.responseVersion(); v != legacyVersion {
+		return v
+	}
+	return ""
+}
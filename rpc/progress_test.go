@@ -0,0 +1,40 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	s := New()
+	s.Register("work", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		p := ProgressFromContext(ctx)
+		for i := 1; i <= 4; i++ {
+			if err := p.Report("job", i*25, fmt.Sprint("step ", i)); err != nil {
+				return nil, err
+			}
+		}
+		return json.RawMessage(`"done"`), nil
+	})
+	out := serve(t, s, `{"jsonrpc":"2.0","method":"work","id":1}`)
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("got %d messages in %q, want 4 reports and the result", len(lines), out)
+	}
+	for i, line := range lines[:4] {
+		want := fmt.Sprintf(`{"jsonrpc":"2.0","method":"$/progress","params":{"token":"job","percent":%d,"message":"step %d"}}`, (i+1)*25, i+1)
+		if line != want {
+			t.Errorf("report %d: got %s, want %s", i, line, want)
+		}
+	}
+	if want := `{"jsonrpc":"2.0","result":"done","id":1}`; lines[4] != want {
+		t.Errorf("got %s, want %s", lines[4], want)
+	}
+	// elsewhere reports are discarded
+	if got := handle(s, `{"jsonrpc":"2.0","method":"work","id":1}`); got != lines[4]+"\n" {
+		t.Errorf("HandleBytes: got %s", got)
+	}
+}
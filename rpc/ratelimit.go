@@ -0,0 +1,91 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket: Rate messages per second on average, with
+// bursts of up to Burst messages. A zero Rate means no limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type tokenBucket struct {
+	limit  RateLimit
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full bucket for limit, or nil if limit is
+// disabled.
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	if limit.Rate <= 0 {
+		return nil
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: time.Now()}
+}
+
+// allow takes a token from b if there is one. A nil bucket always allows.
+func (b *tokenBucket) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	if max := float64(b.limit.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// writeRateLimited answers a message rejected by the rate limit with a Server
+// busy error, carrying the request id for single requests. Rejected
+// notifications are dropped.
+func (r *RpcServer) writeRateLimited(ctx context.Context, msg json.RawMessage, w io.Writer) {
+	r.log(ctx).Logf("Rate limit exceeded")
+	var id json.RawMessage
+	if len(msg) > 0 && msg[0] != '[' {
+		req := new(rpcRequest)
+		_ = json.Unmarshal(msg, req)
+		if req.isNotification(r.legacy) && req.Method != "" {
+			return
+		}
+		id = req.Id
+	}
+	r.writeErrorResponse(NewError(ErrCodeServerBusy), id, w)
+}
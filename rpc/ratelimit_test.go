@@ -0,0 +1,29 @@
+package rpc
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPerConnRateLimit(t *testing.T) {
+	s := echoServer()
+	s.PerConnRateLimit = RateLimit{Rate: 0.001, Burst: 2}
+	msgs := func(n int) string {
+		var b strings.Builder
+		for i := 1; i <= n; i++ {
+			fmt.Fprintf(&b, `{"jsonrpc":"2.0","method":"echo","params":[%d],"id":%d}`, i, i)
+		}
+		return b.String()
+	}
+	busy := fmt.Sprintf(`"code":%d`, ErrCodeServerBusy)
+	first := serve(t, s, msgs(3))
+	if strings.Count(first, `"result"`) != 2 || strings.Count(first, busy) != 1 {
+		t.Fatalf("first connection: got %s, want 2 results and 1 busy error", first)
+	}
+	// a second connection has its own bucket
+	second := serve(t, s, msgs(2))
+	if strings.Count(second, `"result"`) != 2 || strings.Contains(second, busy) {
+		t.Fatalf("second connection: got %s, want 2 results", second)
+	}
+}
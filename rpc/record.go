@@ -0,0 +1,171 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Record is a request and its response as captured by WithRecorder. Response
+// is null if the request got no response.
+type Record struct {
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response"`
+}
+
+// Replay reads records written by WithRecorder from r, passes every request
+// to handle and compares the result with the recorded response. It returns
+// all mismatches joined together, or nil if every response matched.
+func Replay(r io.Reader, handle func([]byte) []byte) error {
+	dec := json.NewDecoder(r)
+	var errs []error
+	for i := 0; ; i++ {
+		var rec Record
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			errs = append(errs, fmt.Errorf("record %d: %w", i, err))
+			break
+		}
+		got, want := compactJSON(handle(rec.Request)), compactJSON(rec.Response)
+		if !bytes.Equal(got, want) {
+			errs = append(errs, fmt.Errorf("record %d: got %s, recorded %s", i, got, want))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type dryRunKey struct{}
+
+// DryRun handles raw, e.g. a request captured by WithRecorder, like
+// HandleBytes, with a context for which IsDryRun reports true. Handlers with
+// side effects must check it and skip them. Dry runs are not recorded by
+// WithRecorder, but OnRawRequest and OnRawResponse still log them. It returns
+// an error if raw is not valid JSON.
+func (r *RpcServer) DryRun(ctx context.Context, raw []byte) ([]byte, error) {
+	if !json.Valid(trimBOM(raw)) {
+		return nil, NewError(ErrCodeParseError)
+	}
+	return r.HandleBytes(context.WithValue(ctx, dryRunKey{}, true), raw), nil
+}
+
+// IsDryRun reports whether the request handled in ctx is a dry run, see
+// RpcServer.DryRun.
+func IsDryRun(ctx context.Context) bool {
+	dry, _ := ctx.Value(dryRunKey{}).(bool)
+	return dry
+}
+
+func compactJSON(b []byte) []byte {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return []byte("null")
+	}
+	buf := new(bytes.Buffer)
+	if err := json.Compact(buf, b); err != nil {
+		return b
+	}
+	return buf.Bytes()
+}
+
+// recorder serializes records written by concurrent requests.
+type recorder struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+type recording struct {
+	r        *RpcServer
+	ctx      context.Context
+	recorder *recorder // nil for dry runs
+	req      json.RawMessage
+	out      bytes.Buffer
+}
+
+// record wraps writer to capture the response if the server has a recorder,
+// except for dry runs, or raw logging hooks. The returned recording is nil
+// otherwise; its methods are no-ops on nil.
+func (r *RpcServer) record(ctx context.Context, writer io.Writer) (*recording, io.Writer) {
+	rec := &recording{r: r, ctx: ctx}
+	if !IsDryRun(ctx) {
+		rec.recorder = r.recorder
+	}
+	if rec.recorder == nil && r.OnRawRequest == nil && r.OnRawResponse == nil {
+		return nil, writer
+	}
+	return rec, io.MultiWriter(&rec.out, writer)
+}
+
+func (rec *recording) request(raw json.RawMessage) {
+	if rec == nil {
+		return
+	}
+	rec.req = raw
+	if rec.r.OnRawRequest != nil {
+		rec.r.log(rec.ctx).Logf("Request: %s", rec.r.OnRawRequest(bytes.Clone(raw)))
+	}
+}
+
+func (rec *recording) done() {
+	if rec == nil || rec.req == nil {
+		// nothing decoded, nothing to log or replay
+		return
+	}
+	if rec.r.OnRawResponse != nil && rec.out.Len() > 0 {
+		rec.r.log(rec.ctx).Logf("Response: %s", bytes.TrimRight(rec.r.OnRawResponse(bytes.Clone(rec.out.Bytes())), "\n"))
+	}
+	if rec.recorder == nil {
+		return
+	}
+	record := Record{Request: rec.req, Response: compactJSON(rec.out.Bytes())}
+	if rec.r.recordRedact != nil {
+		record = rec.r.recordRedact(record)
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		rec.r.log(rec.ctx).Logf("Can't encode record: %v", err)
+		return
+	}
+	rec.recorder.mu.Lock()
+	defer rec.recorder.mu.Unlock()
+	if _, err := rec.recorder.w.Write(append(b, '\n')); err != nil {
+		rec.r.log(rec.ctx).Logf("Can't write record: %v", err)
+	}
+}
+
+// joinBatch encodes batch members back into a batch.
+func joinBatch(batch []json.RawMessage) json.RawMessage {
+	buf := bytes.NewBufferString("[")
+	for i, raw := range batch {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(raw)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
@@ -0,0 +1,102 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	log := new(bytes.Buffer)
+	s := New(WithRecorder(log))
+	counter := 0
+	s.Register("next", func(context.Context, json.RawMessage) (json.RawMessage, error) {
+		counter++
+		return json.Marshal(counter)
+	})
+	for _, req := range []string{
+		`{"jsonrpc":"2.0","method":"next","id":1}`,
+		`[{"jsonrpc":"2.0","method":"next","id":2},{"jsonrpc":"2.0","method":"missing","id":3}]`,
+		`{"jsonrpc":"2.0","method":"next"}`,
+	} {
+		handle(s, req)
+	}
+	recorded := log.String()
+	if n := strings.Count(recorded, "\n"); n != 3 {
+		t.Fatalf("got %d records in %s, want 3", n, recorded)
+	}
+	counter = 0
+	if err := Replay(strings.NewReader(recorded), func(raw []byte) []byte {
+		return s.HandleBytes(context.Background(), raw)
+	}); err != nil {
+		t.Fatalf("replay of the same server: %v", err)
+	}
+	// a server without the method no longer matches the records
+	err := Replay(strings.NewReader(recorded), func(raw []byte) []byte {
+		return New().HandleBytes(context.Background(), raw)
+	})
+	if err == nil || !strings.Contains(err.Error(), "record 0") || !strings.Contains(err.Error(), "record 1") {
+		t.Fatalf("got %v, want mismatches of records 0 and 1", err)
+	}
+}
+
+func TestRawLoggingRedacts(t *testing.T) {
+	logger := &recordLogger{}
+	s := New()
+	s.Logger = logger
+	redact := func(raw []byte) []byte {
+		return bytes.ReplaceAll(raw, []byte("hunter2"), []byte("***"))
+	}
+	s.OnRawRequest, s.OnRawResponse = redact, redact
+	var seen string
+	s.Register("login", Wrap(func(ctx context.Context, p *struct{ Password string }) (string, error) {
+		seen = p.Password
+		return "welcome, hunter2", nil
+	}))
+	resp := handle(s, `{"jsonrpc":"2.0","method":"login","params":{"Password":"hunter2"},"id":1}`)
+	if seen != "hunter2" || !strings.Contains(resp, "welcome, hunter2") {
+		t.Fatalf("handler saw %q, client got %s; want the real values", seen, resp)
+	}
+	if len(logger.lines) != 2 {
+		t.Fatalf("got log %q, want request and response", logger.lines)
+	}
+	for _, line := range logger.lines {
+		if strings.Contains(line, "hunter2") || !strings.Contains(line, "***") {
+			t.Errorf("logged %q, want it redacted", line)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	logger := &recordLogger{}
+	records := new(bytes.Buffer)
+	s := New(WithRecorder(records))
+	s.Logger = logger
+	s.OnRawRequest = func(raw []byte) []byte { return raw }
+	var writes []string
+	s.Register("save", Wrap(func(ctx context.Context, p *struct{ Name string }) (bool, error) {
+		if !IsDryRun(ctx) {
+			writes = append(writes, p.Name)
+		}
+		return true, nil
+	}))
+	resp, err := s.DryRun(context.Background(), []byte(`{"jsonrpc":"2.0","method":"save","params":{"Name":"a"},"id":1}`))
+	if err != nil || !strings.Contains(string(resp), `"result":true`) {
+		t.Fatalf("got %s, %v", resp, err)
+	}
+	if len(writes) != 0 || records.Len() != 0 {
+		t.Fatalf("dry run wrote %q and recorded %q", writes, records)
+	}
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], `"Name":"a"`) {
+		t.Fatalf("got log %q, want the raw request", logger.lines)
+	}
+	handle(s, `{"jsonrpc":"2.0","method":"save","params":{"Name":"b"},"id":1}`)
+	if len(writes) != 1 || records.Len() == 0 {
+		t.Fatalf("real run wrote %q and recorded %q", writes, records)
+	}
+	if _, err := s.DryRun(context.Background(), []byte(`{"jsonrpc"`)); err == nil {
+		t.Fatal("expected an error for invalid JSON")
+	}
+}
@@ -0,0 +1,45 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// ContentRouter returns a handler that dispatches a call to routes by the
+// string value of the discriminator field (a ParamsField path) in params,
+// e.g. "type". Calls without a matching route go to fallback, or fail with
+// Invalid params if fallback is nil. Params are passed on unchanged.
+func ContentRouter(field string, routes map[string]Handler, fallback Handler) Handler {
+	return func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		var key string
+		if raw, ok := ParamsField(params, field); ok {
+			_ = json.Unmarshal(raw, &key)
+		}
+		if h, ok := routes[key]; ok {
+			return h(ctx, params)
+		}
+		if fallback != nil {
+			return fallback(ctx, params)
+		}
+		return nil, NewError(ErrCodeInvalidParams)
+	}
+}
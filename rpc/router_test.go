@@ -0,0 +1,28 @@
+package rpc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContentRouter(t *testing.T) {
+	routes := map[string]Handler{
+		"card": constHandler(`"card"`),
+		"bank": constHandler(`"bank"`),
+	}
+	s := New()
+	s.Register("pay", ContentRouter("method.type", routes, nil))
+	s.Register("payOr", ContentRouter("method.type", routes, constHandler(`"fallback"`)))
+	for req, want := range map[string]string{
+		`"pay","params":{"method":{"type":"card"}}`:   `"result":"card"`,
+		`"pay","params":{"method":{"type":"bank"}}`:   `"result":"bank"`,
+		`"pay","params":{"method":{"type":"cash"}}`:   `"code":-32602`,
+		`"pay","params":{"amount":1}`:                 `"code":-32602`,
+		`"payOr","params":{"method":{"type":"cash"}}`: `"result":"fallback"`,
+		`"payOr","params":[1]`:                        `"result":"fallback"`,
+	} {
+		if got := handle(s, `{"jsonrpc":"2.0","method":`+req+`,"id":1}`); !strings.Contains(got, want) {
+			t.Errorf("%s: got %s, want %s", req, got, want)
+		}
+	}
+}
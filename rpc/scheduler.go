@@ -0,0 +1,141 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// BatchEntry describes a batch member for a BatchScheduler. Members that are
+// not valid requests have an empty Method.
+type BatchEntry struct {
+	Method string
+	Params json.RawMessage
+	Id     json.RawMessage
+}
+
+// BatchScheduler decides the order in which batch members run. It returns
+// groups of indexes into batch: groups run one after another, the members of
+// a group run concurrently. Members not listed in any group run last, as one
+// more group; repeated indexes are ignored. Responses still follow
+// WithBatchResponseOrder and are matched to requests by id.
+type BatchScheduler func(batch []BatchEntry) [][]int
+
+// batchGroups returns the execution groups for batch. Without a scheduler all
+// members run concurrently.
+func (r *RpcServer) batchGroups(batch []json.RawMessage) [][]int {
+	all := make([]int, len(batch))
+	for i := range all {
+		all[i] = i
+	}
+	if r.BatchScheduler == nil {
+		return [][]int{all}
+	}
+	entries := make([]BatchEntry, len(batch))
+	for i, raw := range batch {
+		req := new(rpcRequest)
+		if err := json.Unmarshal(raw, req); err == nil {
+			entries[i] = BatchEntry{Method: req.Method, Params: req.Params, Id: req.Id}
+		}
+	}
+	seen := make([]bool, len(batch))
+	var groups [][]int
+	for _, group := range r.BatchScheduler(entries) {
+		var g []int
+		for _, i := range group {
+			if i >= 0 && i < len(batch) && !seen[i] {
+				seen[i] = true
+				g = append(g, i)
+			}
+		}
+		if len(g) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	var rest []int
+	for _, i := range all {
+		if !seen[i] {
+			rest = append(rest, i)
+		}
+	}
+	if len(rest) > 0 {
+		groups = append(groups, rest)
+	}
+	return groups
+}
+
+// batchOverLimit marks the members of batch that call a method more often
+// than MaxPerBatch allows; calls beyond the cap, in batch order, are marked.
+// Methods are counted by the name they are dispatched to, so aliases share
+// the cap.
+// It returns nil if there are no caps.
+func (r *RpcServer) batchOverLimit(batch []json.RawMessage) []bool {
+	if len(r.MaxPerBatch) == 0 {
+		return nil
+	}
+	over := make([]bool, len(batch))
+	counts := map[string]int{}
+	for i, raw := range batch {
+		req := new(rpcRequest)
+		if err := json.Unmarshal(raw, req); err != nil {
+			continue
+		}
+		method, ok := r.tryResolve(req.Method)
+		if !ok {
+			continue
+		}
+		max, ok := r.MaxPerBatch[method]
+		if !ok {
+			continue
+		}
+		counts[method]++
+		over[i] = counts[method] > max
+	}
+	return over
+}
+
+// tryResolve is resolve for batchOverLimit. If MethodRewriter panics the
+// member is not counted; dispatching it reports the panic.
+func (r *RpcServer) tryResolve(method string) (resolved string, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	return r.resolve(method), true
+}
+
+// batchLimitResponse answers a batch member marked by batchOverLimit.
+func (r *RpcServer) batchLimitResponse(ctx context.Context, raw json.RawMessage) *rpcResponse {
+	req := new(rpcRequest)
+	_ = json.Unmarshal(raw, req)
+	r.log(ctx).Logf("Batch limit of %s exceeded", req.Method)
+	if req.isNotification(r.legacy) {
+		return nil
+	}
+	resp := &rpcResponse{
+		Jsonrpc: r.responseVersion(),
+		Error:   NewError(ErrCodeBatchLimit),
+		Id:      req.Id,
+	}
+	countResponse(ctx, resp)
+	return resp
+}
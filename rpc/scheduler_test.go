@@ -0,0 +1,68 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMaxPerBatchResolvesAliases(t *testing.T) {
+	s := New()
+	s.MaxPerBatch = map[string]int{"search": 1}
+	s.MethodRewriter = func(method string) string {
+		if method == "find" {
+			return "search"
+		}
+		return method
+	}
+	s.Register("search", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage("true"), nil
+	})
+	resp := string(s.HandleBytes(context.Background(), []byte(`[
+		{"jsonrpc":"2.0","method":"search","id":1},
+		{"jsonrpc":"2.0","method":"find","id":2},
+		{"jsonrpc":"2.0","method":"find","id":3}
+	]`)))
+	if n := strings.Count(resp, fmt.Sprint(ErrCodeBatchLimit)); n != 2 {
+		t.Fatalf("%d calls over the limit, want 2: %s", n, resp)
+	}
+}
+
+func TestBatchScheduler(t *testing.T) {
+	s := New()
+	// writes first, one at a time, then all reads together
+	s.BatchScheduler = func(batch []BatchEntry) [][]int {
+		var groups [][]int
+		for i, e := range batch {
+			if e.Method == "write" {
+				groups = append(groups, []int{i})
+			}
+		}
+		return groups
+	}
+	var mu sync.Mutex
+	var started []string
+	record := func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		started = append(started, MethodFromContext(ctx)+string(params))
+		return params, nil
+	}
+	s.Register("read", record)
+	s.Register("write", record)
+	resp := string(s.HandleBytes(context.Background(), []byte(`[
+		{"jsonrpc":"2.0","method":"read","params":[1],"id":1},
+		{"jsonrpc":"2.0","method":"write","params":[2],"id":2},
+		{"jsonrpc":"2.0","method":"write","params":[3],"id":3}
+	]`)))
+	if got := strings.Join(started, " "); got != "write[2] write[3] read[1]" {
+		t.Fatalf("started %s, want writes in order, then the read", got)
+	}
+	want := `[{"jsonrpc":"2.0","result":[1],"id":1},{"jsonrpc":"2.0","result":[2],"id":2},{"jsonrpc":"2.0","result":[3],"id":3}]` + "\n"
+	if resp != want {
+		t.Fatalf("got %s, want %s", resp, want)
+	}
+}
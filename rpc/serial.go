@@ -0,0 +1,81 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// NewSerialHandler returns a handler that runs fn on a single worker
+// goroutine, so fn is never called concurrently and calls run in the order
+// they were handed over. A call whose context is done before fn started
+// returns the context error without running fn. A panic in fn is re-raised
+// in the calling goroutine, so the server reports it as InternalPanic, and the
+// worker goes on with the next call. The worker lives as long as the program.
+func NewSerialHandler(fn Handler) Handler {
+	calls := make(chan serialCall)
+	go func() {
+		for c := range calls {
+			if err := c.ctx.Err(); err != nil {
+				c.done <- serialResult{err: err}
+				continue
+			}
+			c.done <- runSerial(fn, c)
+		}
+	}()
+	return func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		c := serialCall{ctx: ctx, params: params, done: make(chan serialResult, 1)}
+		select {
+		case calls <- c:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		res := <-c.done
+		if res.panicked {
+			panic(res.panic)
+		}
+		return res.result, res.err
+	}
+}
+
+// runSerial calls fn for c, recovering a panic into the result.
+func runSerial(fn Handler, c serialCall) (res serialResult) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			res = serialResult{panicked: true, panic: rec}
+		}
+	}()
+	result, err := fn(c.ctx, c.params)
+	return serialResult{result: result, err: err}
+}
+
+type serialCall struct {
+	ctx    context.Context
+	params json.RawMessage
+	done   chan serialResult
+}
+
+type serialResult struct {
+	result   json.RawMessage
+	err      error
+	panicked bool
+	panic    any
+}
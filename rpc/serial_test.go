@@ -0,0 +1,54 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSerialHandlerNotConcurrent(t *testing.T) {
+	s := New()
+	running, calls := 0, 0
+	s.Register("inc", NewSerialHandler(func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		running++
+		defer func() { running-- }()
+		if running != 1 {
+			t.Errorf("%d concurrent calls", running)
+		}
+		calls++
+		return json.RawMessage("true"), nil
+	}))
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.HandleBytes(context.Background(), []byte(fmt.Sprintf(`{"jsonrpc":"2.0","method":"inc","id":%d}`, i)))
+		}(i)
+	}
+	wg.Wait()
+	if calls != 20 {
+		t.Fatalf("got %d calls, want 20", calls)
+	}
+}
+
+func TestSerialHandlerPanic(t *testing.T) {
+	s := New()
+	s.Register("boom", NewSerialHandler(func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		if string(params) == `["panic"]` {
+			panic("boom")
+		}
+		return json.RawMessage("true"), nil
+	}))
+	resp := s.HandleBytes(context.Background(), []byte(`{"jsonrpc":"2.0","method":"boom","params":["panic"],"id":1}`))
+	if !strings.Contains(string(resp), `"code":-32603`) {
+		t.Fatalf("expected internal error, got %s", resp)
+	}
+	resp = s.HandleBytes(context.Background(), []byte(`{"jsonrpc":"2.0","method":"boom","params":[],"id":2}`))
+	if !strings.Contains(string(resp), `"result":true`) {
+		t.Fatalf("worker did not survive the panic, got %s", resp)
+	}
+}
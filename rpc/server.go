@@ -22,125 +22,832 @@ package rpc
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-const version = "2.0"
+const (
+	version       = "2.0"
+	legacyVersion = "1.0"
+)
 
 type RpcServer struct {
-	Logger              Logger
+	Logger Logger
+	// IgnoreNotifications silences logging of failed notifications. As the
+	// spec requires, notifications never get a response either way.
 	IgnoreNotifications bool
-	handlers            map[string]Handler
+	MaxConnections      int
+	// HandlerTimeout bounds every handler call unless the method was
+	// registered with its own timeout. Zero means no timeout.
+	HandlerTimeout time.Duration
+	// MethodRewriter, if set, maps the requested method name before handler
+	// lookup, e.g. to resolve aliases. An empty result means method not found.
+	MethodRewriter func(method string) string
+	// WriteTimeout bounds writing a response to writers with write deadlines,
+	// e.g. a net.Conn or, in the http package, the http.ResponseWriter. Zero
+	// means no timeout.
+	WriteTimeout time.Duration
+	// MaxResponseBytes replaces results longer than this, once encoded, with
+	// an Internal error. Zero means no limit.
+	MaxResponseBytes int64
+	// MaxParamsDepth rejects params nested deeper than this with Invalid
+	// params before the handler runs. Zero disables the check.
+	MaxParamsDepth int
+	// OnStats, if set, is called after each single request or batch with its
+	// size and decoding time.
+	OnStats func(ctx context.Context, stats Stats)
+	// OnDroppedNotification, if set, is called with the method of every
+	// notification for an unknown method while IgnoreNotifications is set,
+	// e.g. to count client bugs.
+	OnDroppedNotification func(method string)
+	// OnRawRequest and OnRawResponse, if set, get a copy of the raw bytes of
+	// every decoded request or batch and of its response. What they return is
+	// written to Logger, e.g. with secrets redacted; processing is not
+	// affected.
+	OnRawRequest  func(raw []byte) []byte
+	OnRawResponse func(raw []byte) []byte
+	// MaxPerBatch caps how often a method, by the name it is dispatched to
+	// after MethodRewriter, may be called within one batch. Calls beyond the
+	// cap get an ErrCodeBatchLimit error, the rest of the batch is handled as
+	// usual.
+	MaxPerBatch map[string]int
+	// BatchScheduler, if set, orders the execution of batch members. By
+	// default all members run concurrently.
+	BatchScheduler BatchScheduler
+	// PerConnRateLimit limits the messages Serve accepts per connection, each
+	// top-level request or batch taking one token. Messages over the limit
+	// are answered with a Server busy error.
+	PerConnRateLimit RateLimit
+	// ContextEnricher, if set, derives the context of a request or batch
+	// before it is decoded, e.g. to attach transport metadata. Serve calls it
+	// once per connection. All handlers of the request inherit its result.
+	ContextEnricher func(ctx context.Context) context.Context
+	// ErrorTransformer, if set, maps a handler error to the one sent to the
+	// client, e.g. to hide internal details. The original error is still
+	// logged. If it returns nil the original error is sent.
+	ErrorTransformer func(ctx context.Context, method string, err error) error
+	// ErrorMapper, if set, maps a handler error that is not an Error, e.g. a
+	// custom error type, to the one sent to the client, before the
+	// ErrorTransformer. Such errors of handlers made with Wrap or
+	// RegisterMethod reach it as ErrUser errors wrapping the original. Errors
+	// it leaves alone (returning nil) that are not an Error are sent as
+	// ErrUser errors with their message.
+	ErrorMapper         func(err error) error
+	handlers            map[string]methodEntry
 	mu                  sync.RWMutex
+	clientTimeoutMax    time.Duration
+	omitVersion         bool
+	strictParams        bool
+	unorderedBatch      bool
+	paused              atomic.Bool
+	middlewares         []Middleware
+	notificationAudit   func(method string, resp []byte)
+	ndjson              bool
+	legacy              bool
+	errorChainData      bool
+	recorder            *recorder
+	recordRedact        func(rec Record) Record
+	internalMessages    map[InternalFailure]string
+	methodNameValidator func(method string) error
+	inFlight            map[uint64]InFlightInfo
+	inFlightSeq         uint64
+	inFlightMu          sync.Mutex
+	retryMax            int
+	retryBackoff        func(attempt int) time.Duration
+	idGenerator         func() string
+	strictParamsType    bool
+	deprecationWarnings bool
+	readiness           func() bool
+	correlationID       func(ctx context.Context, params json.RawMessage) string
+	nilResultError      bool
 }
 
-func New() *RpcServer {
-	return &RpcServer{
+func New(opts ...Option) *RpcServer {
+	r := &RpcServer{
 		Logger:              nopLogger{},
 		IgnoreNotifications: true,
-		handlers:            map[string]Handler{},
+		handlers:            map[string]methodEntry{},
 		mu:                  sync.RWMutex{},
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// clone returns a server with the same configuration as r and no handlers.
+func (r *RpcServer) clone() *RpcServer {
+	return &RpcServer{
+		Logger:                r.Logger,
+		IgnoreNotifications:   r.IgnoreNotifications,
+		MaxConnections:        r.MaxConnections,
+		HandlerTimeout:        r.HandlerTimeout,
+		MethodRewriter:        r.MethodRewriter,
+		WriteTimeout:          r.WriteTimeout,
+		MaxParamsDepth:        r.MaxParamsDepth,
+		MaxResponseBytes:      r.MaxResponseBytes,
+		OnStats:               r.OnStats,
+		OnDroppedNotification: r.OnDroppedNotification,
+		BatchScheduler:        r.BatchScheduler,
+		MaxPerBatch:           r.MaxPerBatch,
+		OnRawRequest:          r.OnRawRequest,
+		OnRawResponse:         r.OnRawResponse,
+		PerConnRateLimit:      r.PerConnRateLimit,
+		ContextEnricher:       r.ContextEnricher,
+		ErrorTransformer:      r.ErrorTransformer,
+		ErrorMapper:           r.ErrorMapper,
+		handlers:              map[string]methodEntry{},
+		mu:                    sync.RWMutex{},
+		clientTimeoutMax:      r.clientTimeoutMax,
+		omitVersion:           r.omitVersion,
+		strictParams:          r.strictParams,
+		unorderedBatch:        r.unorderedBatch,
+		middlewares:           r.middlewares,
+		notificationAudit:     r.notificationAudit,
+		ndjson:                r.ndjson,
+		legacy:                r.legacy,
+		errorChainData:        r.errorChainData,
+		recorder:              r.recorder,
+		recordRedact:          r.recordRedact,
+		internalMessages:      r.internalMessages,
+		methodNameValidator:   r.methodNameValidator,
+		retryMax:              r.retryMax,
+		retryBackoff:          r.retryBackoff,
+		idGenerator:           r.idGenerator,
+		strictParamsType:      r.strictParamsType,
+		deprecationWarnings:   r.deprecationWarnings,
+		readiness:             r.readiness,
+		correlationID:         r.correlationID,
+		nilResultError:        r.nilResultError,
+	}
 }
 
 func (r *RpcServer) Register(method string, handler Handler) {
+	r.register(method, methodEntry{handler: handler})
+}
+
+// RegisterWithTimeout registers handler with its own timeout, overriding
+// HandlerTimeout. Zero means use HandlerTimeout, negative means no timeout.
+func (r *RpcServer) RegisterWithTimeout(method string, handler Handler, d time.Duration) {
+	r.register(method, methodEntry{handler: handler, timeout: d})
+}
+
+// ResultEncoder re-encodes a handler result before it is sent, e.g. to embed
+// a binary encoding of it as a JSON string. It gets the result as returned by
+// the handler and returns the value of the response result member.
+type ResultEncoder func(result json.RawMessage) (json.RawMessage, error)
+
+// RegisterWithEncoder registers handler and encodes its results with encoder
+// instead of sending them as is.
+func (r *RpcServer) RegisterWithEncoder(method string, handler Handler, encoder ResultEncoder) {
+	r.register(method, methodEntry{handler: handler, encoder: encoder})
+}
+
+// RegisterAll registers all handlers at once, under a single lock. Like
+// Register, it replaces handlers already registered with the same name.
+func (r *RpcServer) RegisterAll(handlers map[string]Handler) {
+	for method := range handlers {
+		r.mustValidName(method)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for method, handler := range handlers {
+		r.handlers[method] = methodEntry{handler: handler}
+	}
+}
+
+// RegisterWithMaxParams registers handler and rejects calls whose raw params
+// are longer than maxBytes with Invalid params, before the handler runs.
+func (r *RpcServer) RegisterWithMaxParams(method string, handler Handler, maxBytes int) {
+	r.register(method, methodEntry{handler: handler, maxParams: maxBytes})
+}
+
+// MethodMeta describes a method for tooling, see RegisterWithMeta.
+type MethodMeta struct {
+	Description string `json:"description,omitempty"`
+	Deprecated  bool   `json:"deprecated,omitempty"`
+	Since       string `json:"since,omitempty"`
+}
+
+// RegisterWithMeta registers handler with metadata returned by Methods.
+func (r *RpcServer) RegisterWithMeta(method string, handler Handler, meta MethodMeta) {
+	r.register(method, methodEntry{handler: handler, meta: meta})
+}
+
+// Methods returns the metadata of all registered methods, e.g. for a
+// discovery method or documentation. Methods registered without metadata have
+// a zero MethodMeta.
+func (r *RpcServer) Methods() map[string]MethodMeta {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	methods := make(map[string]MethodMeta, len(r.handlers))
+	for method, m := range r.handlers {
+		methods[method] = m.meta
+	}
+	return methods
+}
+
+func (r *RpcServer) register(method string, m methodEntry) {
+	r.mustValidName(method)
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.handlers[method] = handler
+	r.handlers[method] = m
+}
+
+// validName checks method against the validator set with
+// WithMethodNameValidator.
+func (r *RpcServer) validName(method string) error {
+	if r.methodNameValidator == nil {
+		return nil
+	}
+	if err := r.methodNameValidator(method); err != nil {
+		return fmt.Errorf("jsonrpc2: invalid method name %q: %w", method, err)
+	}
+	return nil
+}
+
+func (r *RpcServer) mustValidName(method string) {
+	if err := r.validName(method); err != nil {
+		panic(err)
+	}
+}
+
+// Snapshot returns a copy of the registered handlers.
+func (r *RpcServer) Snapshot() map[string]Handler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	handlers := make(map[string]Handler, len(r.handlers))
+	for method, m := range r.handlers {
+		handlers[method] = m.handler
+	}
+	return handlers
+}
+
+// Restore atomically replaces all registered handlers with handlers, e.g. a
+// Snapshot or a freshly built set for a hot reload. Per-method settings of
+// the previous handlers (see RegisterWithTimeout) are not kept.
+func (r *RpcServer) Restore(handlers map[string]Handler) {
+	entries := make(map[string]methodEntry, len(handlers))
+	for method, h := range handlers {
+		entries[method] = methodEntry{handler: h}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers = entries
+}
+
+// Pause makes the server reply to all requests with a retryable
+// ErrCodeUnavailable error until Resume is called. Connections stay open.
+func (r *RpcServer) Pause() {
+	r.paused.Store(true)
+}
+
+// Resume resumes dispatching requests after Pause.
+func (r *RpcServer) Resume() {
+	r.paused.Store(false)
+}
+
+// Ready reports whether the readiness function set with WithReadiness, if
+// any, reports the server ready.
+func (r *RpcServer) Ready() bool {
+	return r.readiness == nil || r.readiness()
 }
 
 func (r *RpcServer) SingleRequest(ctx context.Context, reader io.Reader, writer io.Writer) {
-	req := new(rpcRequest)
-	if err := json.NewDecoder(reader).Decode(req); err != nil {
-		r.Logger.Logf("Can't read body: %v", err)
-		WriteError(ErrCodeParseError, writer)
+	ctx = r.enrich(ctx)
+	stats, reader, writer := r.recordStats(ctx, reader, r.timeoutWriter(writer), false)
+	defer stats.done()
+	rec, writer := r.record(ctx, writer)
+	defer rec.done()
+	var raw json.RawMessage
+	start := time.Now()
+	err := json.NewDecoder(reader).Decode(&raw)
+	stats.decoded(start)
+	if err != nil {
+		r.log(ctx).Logf("Can't read body: %v", err)
+		r.writeError(ErrCodeParseError, writer)
 		return
 	}
-	resp := r.callMethod(ctx, req)
-	if req.Id == nil && r.IgnoreNotifications {
-		// notification request
+	rec.request(raw)
+	resp := r.handleRequest(ctx, raw)
+	if resp == nil {
+		return
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		r.log(ctx).Logf("Can't marshal response: %v", err)
+		r.writeErrorResponse(r.internalError(InternalMarshal), resp.Id, writer)
 		return
 	}
-	if err := json.NewEncoder(writer).Encode(resp); err != nil {
-		r.Logger.Logf("Can't write response: %v", err)
-		WriteError(ErrCodeInternalError, writer)
+	if _, err := writer.Write(append(b, '\n')); err != nil {
+		r.log(ctx).Logf("Can't write response: %v", err)
+		r.writeErrorResponse(r.internalError(InternalWrite), resp.Id, writer)
 		return
 	}
 }
 
 func (r *RpcServer) BatchRequest(ctx context.Context, reader io.Reader, writer io.Writer) {
-	var req []rpcRequest
-	if err := json.NewDecoder(reader).Decode(&req); err != nil {
-		r.Logger.Logf("Can't read body: %v", err)
-		WriteError(ErrCodeParseError, writer)
+	ctx = r.enrich(ctx)
+	stats, reader, writer := r.recordStats(ctx, reader, r.timeoutWriter(writer), true)
+	defer stats.done()
+	rec, writer := r.record(ctx, writer)
+	defer rec.done()
+	var batch []json.RawMessage
+	start := time.Now()
+	data, err := io.ReadAll(reader)
+	if err == nil {
+		batch, err = splitBatch(data)
+	}
+	stats.decoded(start)
+	if err != nil {
+		r.log(ctx).Logf("Can't read body: %v", err)
+		r.writeError(ErrCodeParseError, writer)
 		return
 	}
-	var responses []*rpcResponse
-	wg := sync.WaitGroup{}
-	wg.Add(len(req))
-	for _, j := range req {
-		go func(req rpcRequest) {
-			defer wg.Done()
-			resp := r.callMethod(ctx, &req)
-			if req.Id == nil && r.IgnoreNotifications {
-				// notification request
-				return
+	if rec != nil {
+		rec.request(joinBatch(batch))
+	}
+	if len(batch) == 0 {
+		r.writeError(ErrCodeInvalidRequest, writer)
+		return
+	}
+	responses := r.handleBatch(withBatchID(ctx, r.newID()), batch)
+	if len(responses) == 0 {
+		// batch of notifications only, nothing to reply
+		return
+	}
+	if err := r.writeBatch(writer, responses); err != nil {
+		r.log(ctx).Logf("Can't write batch response: %v", err)
+	}
+}
+
+// writeBatch encodes responses one by one, so that a failing response does not
+// take down the whole batch. A response that can't be marshaled is replaced
+// with an Internal error. A failed write ends the batch, as the array can't be
+// completed. All failures are returned joined together.
+func (r *RpcServer) writeBatch(w io.Writer, responses []*rpcResponse) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	var errs []error
+	sep := ""
+	for i, resp := range responses {
+		b, err := json.Marshal(resp)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("response %d (id %s): %w", i, resp.Id, err))
+			if b, err = json.Marshal(rpcResponse{
+				Jsonrpc: r.responseVersion(),
+				Error:   r.internalError(InternalMarshal),
+				Id:      resp.Id,
+			}); err != nil {
+				continue
 			}
+		}
+		if _, err := io.WriteString(w, sep+string(b)); err != nil {
+			errs = append(errs, fmt.Errorf("response %d (id %s): %w", i, resp.Id, err))
+			return errors.Join(errs...)
+		}
+		sep = ","
+	}
+	if _, err := io.WriteString(w, "]\n"); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// handleBatch dispatches batch members concurrently, in the groups given by
+// the BatchScheduler if set. Responses are returned in request order, or in
+// completion order if the server uses WithBatchResponseOrder(false).
+func (r *RpcServer) handleBatch(ctx context.Context, batch []json.RawMessage) []*rpcResponse {
+	return r.streamBatch(ctx, batch, nil)
+}
+
+// streamBatch is handleBatch that also passes every response to emit, if not
+// nil, as soon as it is ready. emit is never called concurrently.
+func (r *RpcServer) streamBatch(ctx context.Context, batch []json.RawMessage, emit func(resp *rpcResponse)) []*rpcResponse {
+	results := make([]*rpcResponse, len(batch))
+	var completed []*rpcResponse
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	over := r.batchOverLimit(batch)
+	for _, group := range r.batchGroups(batch) {
+		wg.Add(len(group))
+		for _, i := range group {
+			go func(i int, raw json.RawMessage) {
+				defer wg.Done()
+				defer func() {
+					if rec := recover(); rec != nil {
+						r.log(ctx).Logf("Panic in batch member %d: %v", i, rec)
+					}
+				}()
+				var resp *rpcResponse
+				if over != nil && over[i] {
+					resp = r.batchLimitResponse(ctx, raw)
+				} else {
+					resp = r.handleRequest(ctx, raw)
+				}
+				if resp == nil {
+					return
+				}
+				if emit != nil {
+					mu.Lock()
+					emit(resp)
+					mu.Unlock()
+				}
+				if r.unorderedBatch {
+					mu.Lock()
+					completed = append(completed, resp)
+					mu.Unlock()
+					return
+				}
+				results[i] = resp
+			}(i, batch[i])
+		}
+		wg.Wait()
+	}
+	if r.unorderedBatch {
+		return completed
+	}
+	responses := results[:0]
+	for _, resp := range results {
+		if resp != nil {
 			responses = append(responses, resp)
-		}(j)
+		}
+	}
+	return responses
+}
+
+// handleRequest decodes and dispatches a single request. It returns nil if no
+// response must be sent.
+func (r *RpcServer) handleRequest(ctx context.Context, raw json.RawMessage) (resp *rpcResponse) {
+	ctx = trackCall(ctx)
+	req := new(rpcRequest)
+	defer func() {
+		// hooks run outside of safeCall, e.g. MethodRewriter or ErrorMapper,
+		// may panic too
+		if rec := recover(); rec != nil {
+			r.log(ctx).Logf("Panic while handling %s: %v", req.Method, rec)
+			resp = nil
+			if !req.isNotification(r.legacy) {
+				resp = &rpcResponse{
+					Jsonrpc: r.responseVersion(),
+					Error:   r.internalError(InternalPanic),
+				}
+				if validId(req.Id) {
+					resp.Id = req.Id
+				}
+			}
+		}
+		countResponse(ctx, resp)
+	}()
+	if err := json.Unmarshal(raw, req); err != nil {
+		r.log(ctx).Logf("Invalid request: %v", err)
+		return &rpcResponse{
+			Jsonrpc: r.responseVersion(),
+			Error:   NewError(ErrCodeInvalidRequest),
+		}
+	}
+	if err := r.checkRequest(req); err != nil {
+		r.log(ctx).Logf("Invalid request: %v", err)
+		resp := &rpcResponse{
+			Jsonrpc: r.responseVersion(),
+			Error:   NewError(ErrCodeInvalidRequest),
+		}
+		if validId(req.Id) {
+			resp.Id = req.Id
+		}
+		return resp
 	}
-	wg.Wait()
-	if err := json.NewEncoder(writer).Encode(responses); err != nil {
-		r.Logger.Logf("Can't write response: %v", err)
-		WriteError(ErrCodeInternalError, writer)
+	if r.correlationID != nil {
+		if id := r.correlationID(ctx, req.Params); id != "" {
+			ctx = context.WithValue(ctx, correlationIDKey{}, id)
+		}
+	}
+	resp = r.callMethod(ctx, req)
+	if req.isNotification(r.legacy) {
+		if r.IgnoreNotifications && r.OnDroppedNotification != nil && errors.Is(resp.Error, ErrMethodNotFound) {
+			r.OnDroppedNotification(req.Method)
+		}
+		if resp.Error != nil && r.IgnoreNotifications && r.notificationAudit != nil {
+			r.auditNotification(req, resp)
+		}
+		return nil
 	}
+	resp.CorrelationID = CorrelationIDFromContext(ctx)
+	return resp
+}
+
+func (r *RpcServer) auditNotification(req *rpcRequest, resp *rpcResponse) {
+	b, err := json.Marshal(resp)
+	if err != nil {
+		r.log(context.Background()).Logf("Can't encode notification audit record: %v", err)
+		return
+	}
+	r.notificationAudit(req.Method, b)
 }
 
 func (r *RpcServer) callMethod(ctx context.Context, req *rpcRequest) *rpcResponse {
-	r.mu.RLock()
-	h, ok := r.handlers[req.Method]
-	r.mu.RUnlock()
+	if r.paused.Load() {
+		return &rpcResponse{
+			Jsonrpc: r.responseVersion(),
+			Error:   NewError(ErrCodeUnavailable),
+			Id:      req.Id,
+		}
+	}
+	if !r.Ready() {
+		return &rpcResponse{
+			Jsonrpc: r.responseVersion(),
+			Error:   Error{Code: ErrCodeUnavailable, Message: "Not ready"},
+			Id:      req.Id,
+		}
+	}
+	m, ok := r.lookup(req.Method)
 	if !ok {
+		// let middlewares see unknown methods, e.g. to provide a fallback
+		m = methodEntry{handler: methodNotFound}
+	}
+	if err := r.checkParams(req, m); err != nil {
+		r.log(ctx).Logf("Invalid params: %v", err)
 		return &rpcResponse{
-			Jsonrpc: version,
-			Error:   NewError(ErrCodeMethodNotFound),
+			Jsonrpc: r.responseVersion(),
+			Error:   NewError(ErrCodeInvalidParams),
+			Id:      req.Id,
+		}
+	}
+	ctx, cancel := r.requestContext(ctx, req, m)
+	defer cancel()
+	if r.strictParams {
+		ctx = context.WithValue(ctx, strictParamsKey{}, true)
+	}
+	ctx = withRequest(ctx, r.log(ctx), req)
+	if m.meta.Deprecated && r.deprecationWarnings {
+		LoggerFromContext(ctx).Logf("Deprecated method %s called", req.Method)
+	}
+	h := m.handler
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		h = r.middlewares[i](h)
+	}
+	untrack := r.track(req)
+	resp, panicked, err := r.retryCall(ctx, req, h)
+	untrack()
+	if panicked {
+		return &rpcResponse{
+			Jsonrpc: r.responseVersion(),
+			Error:   r.internalError(InternalPanic),
+			Id:      req.Id,
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		r.log(ctx).Logf("Method %s timed out", req.Method)
+		return &rpcResponse{
+			Jsonrpc: r.responseVersion(),
+			Error:   NewError(ErrCodeTimeout),
+			Id:      req.Id,
+		}
+	}
+	if errors.Is(err, ErrMethodNotFound) {
+		return &rpcResponse{
+			Jsonrpc: r.responseVersion(),
+			Error:   ErrMethodNotFound,
 			Id:      req.Id,
 		}
 	}
-	resp, err := h(ctx, req.Params)
 	if err != nil {
-		r.Logger.Logf("User error %v", err)
+		r.logError(ctx, req, err)
+		cause := err
+		if r.ErrorMapper != nil && mappable(err) {
+			if merr := r.ErrorMapper(err); merr != nil {
+				err = merr
+			}
+		}
+		if r.ErrorTransformer != nil {
+			if terr := r.ErrorTransformer(ctx, req.Method, err); terr != nil {
+				err = terr
+			}
+		}
+		err = toError(err)
+		if r.errorChainData {
+			err = withErrorChain(err, cause)
+		}
 		return &rpcResponse{
-			Jsonrpc: version,
+			Jsonrpc: r.responseVersion(),
 			Error:   err,
 			Id:      req.Id,
 		}
 	}
+	if m.encoder != nil {
+		if resp, err = m.encoder(resp); err != nil {
+			r.log(ctx).Logf("Can't encode result of %s: %v", req.Method, err)
+			return &rpcResponse{
+				Jsonrpc: r.responseVersion(),
+				Error:   r.internalError(InternalEncode),
+				Id:      req.Id,
+			}
+		}
+	}
+	if r.MaxResponseBytes > 0 && int64(len(resp)) > r.MaxResponseBytes {
+		r.log(ctx).Logf("Result of %s too large: %d bytes", req.Method, len(resp))
+		return &rpcResponse{
+			Jsonrpc: r.responseVersion(),
+			Error:   r.internalError(InternalTooLarge),
+			Id:      req.Id,
+		}
+	}
+	if r.nilResultError && (resp == nil || string(resp) == "null") {
+		r.log(ctx).Logf("Method %s returned no result", req.Method)
+		return &rpcResponse{
+			Jsonrpc: r.responseVersion(),
+			Error:   r.internalError(InternalNilResult),
+			Id:      req.Id,
+		}
+	}
 	return &rpcResponse{
-		Jsonrpc: version,
+		Jsonrpc: r.responseVersion(),
 		Result:  resp,
 		Id:      req.Id,
 	}
 }
 
-func WriteError(code int, w io.Writer) {
-	_ = json.NewEncoder(w).Encode(rpcResponse{
-		Jsonrpc: version,
-		Error:   NewError(code),
-	})
+func methodNotFound(context.Context, json.RawMessage) (json.RawMessage, error) {
+	return nil, ErrMethodNotFound
+}
+
+// resolve returns the name method is dispatched to, see MethodRewriter.
+func (r *RpcServer) resolve(method string) string {
+	if r.MethodRewriter != nil {
+		return r.MethodRewriter(method)
+	}
+	return method
+}
+
+func (r *RpcServer) lookup(method string) (methodEntry, bool) {
+	method = r.resolve(method)
+	if method == "" {
+		return methodEntry{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.handlers[method]
+	return m, ok
+}
+
+func (r *RpcServer) logError(ctx context.Context, req *rpcRequest, err error) {
+	if !req.isNotification(r.legacy) {
+		r.log(ctx).Logf("User error %v", err)
+		return
+	}
+	if !r.IgnoreNotifications {
+		r.log(ctx).Logf("Notification %s error %v", req.Method, err)
+	}
+}
+
+// retryCall is safeCall, repeated while h fails with a Retryable error, up to
+// the count set by WithHandlerRetry.
+func (r *RpcServer) retryCall(ctx context.Context, req *rpcRequest, h Handler) (json.RawMessage, bool, error) {
+	for attempt := 1; ; attempt++ {
+		resp, panicked, err := r.safeCall(ctx, req, h)
+		var re Retryable
+		if attempt > r.retryMax || !errors.As(err, &re) || !re.Retryable() {
+			return resp, panicked, err
+		}
+		var wait time.Duration
+		if r.retryBackoff != nil {
+			wait = r.retryBackoff(attempt)
+		}
+		r.log(ctx).Logf("Method %s failed, retry %d in %v: %v", req.Method, attempt, wait, err)
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return resp, panicked, err
+		case <-t.C:
+		}
+	}
+}
+
+// safeCall calls h and recovers a panic in it, reporting it as panicked.
+func (r *RpcServer) safeCall(ctx context.Context, req *rpcRequest, h Handler) (resp json.RawMessage, panicked bool, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			r.log(ctx).Logf("Method %s panicked: %v", req.Method, p)
+			resp, panicked, err = nil, true, nil
+		}
+	}()
+	resp, err = h(ctx, req.Params)
+	return resp, false, err
+}
+
+func (r *RpcServer) requestContext(ctx context.Context, req *rpcRequest, m methodEntry) (context.Context, context.CancelFunc) {
+	timeout := m.timeout
+	if timeout == 0 {
+		timeout = r.HandlerTimeout
+	}
+	if r.clientTimeoutMax > 0 && req.TimeoutMs > 0 {
+		client := time.Duration(req.TimeoutMs) * time.Millisecond
+		if client > r.clientTimeoutMax {
+			client = r.clientTimeoutMax
+		}
+		if timeout <= 0 || client < timeout {
+			timeout = client
+		}
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (r *RpcServer) responseVersion() string {
+	if r.legacy {
+		return legacyVersion
+	}
+	if r.omitVersion {
+		return ""
+	}
+	return version
+}
+
+// internalError returns the Internal error reported for failure f.
+func (r *RpcServer) internalError(f InternalFailure) Error {
+	msg, ok := r.internalMessages[f]
+	if !ok {
+		msg = internalMessages[f]
+	}
+	return Error{Code: ErrCodeInternalError, Message: msg}
+}
+
+func (r *RpcServer) WriteError(code int, w io.Writer) {
+	r.writeError(code, r.timeoutWriter(w))
+}
+
+// writeError is WriteError for writers already prepared by the server.
+func (r *RpcServer) writeError(code int, w io.Writer) {
+	r.writeErrorResponse(NewError(code), nil, w)
+}
+
+func (r *RpcServer) writeErrorResponse(e Error, id json.RawMessage, w io.Writer) {
+	if err := json.NewEncoder(w).Encode(rpcResponse{
+		Jsonrpc: r.responseVersion(),
+		Error:   e,
+		Id:      id,
+	}); err != nil {
+		r.log(context.Background()).Logf("Can't write error response: %v", err)
+	}
+}
+
+type methodEntry struct {
+	handler   Handler
+	timeout   time.Duration
+	encoder   ResultEncoder
+	maxParams int
+	meta      MethodMeta
 }
 
 type rpcRequest struct {
 	Jsonrpc string          `json:"jsonrpc"`
 	Method  string          `json:"method"`
 	Params  json.RawMessage `json:"params"`
-	Id      any             `json:"id"`
+	Id      json.RawMessage `json:"id"`
+
+	TimeoutMs int64 `json:"timeout_ms,omitempty"` // extension, see WithClientTimeouts
+}
+
+// isNotification reports whether the request has no id, or in 1.0 mode
+// (legacy) a null one. In 2.0 a request with a null id is answered. The id is
+// kept as sent, so that the response echoes it with the same JSON type and
+// precision.
+func (r *rpcRequest) isNotification(legacy bool) bool {
+	return r.Id == nil || legacy && string(r.Id) == "null"
 }
 
 type rpcResponse struct {
-	Jsonrpc string          `json:"jsonrpc"`
+	Jsonrpc string          `json:"jsonrpc,omitempty"`
 	Result  json.RawMessage `json:"result,omitempty"`
 	Error   error           `json:"error,omitempty"`
-	Id      any             `json:"id,omitempty"`
+	Id      json.RawMessage `json:"id"`
+
+	CorrelationID string `json:"correlation_id,omitempty"` // extension, see WithCorrelationID
+}
+
+// MarshalJSON encodes responses of servers in 1.0 mode (see
+// WithProtocolVersion) without the "jsonrpc" member and with both "result"
+// and "error" present, one of them null. Otherwise a success always has a
+// "result" member, null if the handler returned none, as the spec requires.
+func (r rpcResponse) MarshalJSON() ([]byte, error) {
+	if r.Jsonrpc == legacyVersion {
+		return json.Marshal(struct {
+			Result json.RawMessage `json:"result"`
+			Error  error           `json:"error"`
+			Id     json.RawMessage `json:"id"`
+		}{r.Result, r.Error, r.Id})
+	}
+	if r.Error == nil && r.Result == nil {
+		r.Result = json.RawMessage("null")
+	}
+	type response rpcResponse
+	return json.Marshal(response(r))
 }
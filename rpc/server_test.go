@@ -0,0 +1,413 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func constHandler(result string) Handler {
+	return func(context.Context, json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(result), nil
+	}
+}
+
+func TestRestoreWhileServing(t *testing.T) {
+	s := New()
+	sets := []map[string]Handler{
+		{"a": constHandler(`"v1"`), "b": constHandler(`"v1"`)},
+		{"a": constHandler(`"v2"`), "b": constHandler(`"v2"`)},
+	}
+	s.Restore(sets[0])
+	stop := make(chan struct{})
+	swapped := make(chan struct{})
+	go func() {
+		defer close(swapped)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				s.Restore(sets[i%2])
+			}
+		}
+	}()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				resp := string(s.HandleBytes(context.Background(), []byte(`{"jsonrpc":"2.0","method":"a","id":1}`)))
+				if !strings.Contains(resp, `"result":"v1"`) && !strings.Contains(resp, `"result":"v2"`) {
+					t.Errorf("unexpected response %s", resp)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-swapped
+	if snap := s.Snapshot(); len(snap) != 2 {
+		t.Fatalf("snapshot has %d handlers, want 2", len(snap))
+	}
+}
+
+// handle dispatches the single request or batch req and returns the response.
+func handle(s *RpcServer, req string) string {
+	return string(s.HandleBytes(context.Background(), []byte(req)))
+}
+
+func TestRequestIds(t *testing.T) {
+	s := New()
+	s.Register("a", constHandler(`1`))
+	for id, want := range map[string]string{
+		`"abc"`:   `{"jsonrpc":"2.0","result":1,"id":"abc"}` + "\n",
+		`5`:       `{"jsonrpc":"2.0","result":1,"id":5}` + "\n",
+		`null`:    `{"jsonrpc":"2.0","result":1,"id":null}` + "\n",
+		`1.5e400`: `{"jsonrpc":"2.0","result":1,"id":1.5e400}` + "\n",
+	} {
+		if got := handle(s, `{"jsonrpc":"2.0","method":"a","id":`+id+`}`); got != want {
+			t.Errorf("id %s: got %s, want %s", id, got, want)
+		}
+	}
+	if got := handle(s, `{"jsonrpc":"2.0","method":"a"}`); got != "" {
+		t.Errorf("notification answered: %s", got)
+	}
+	legacy := New(WithProtocolVersion("1.0"))
+	legacy.Register("a", constHandler(`1`))
+	if got := handle(legacy, `{"method":"a","id":null}`); got != "" {
+		t.Errorf("1.0 notification answered: %s", got)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestWriteErrorLogsFailure(t *testing.T) {
+	logger := &recordLogger{}
+	s := New()
+	s.Logger = logger
+	s.WriteError(ErrCodeParseError, failingWriter{})
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "broken pipe") {
+		t.Fatalf("got log %q, want the write error", logger.lines)
+	}
+}
+
+// decodeResult decodes the result of the single response resp into v.
+func decodeResult(t *testing.T, resp string, v any) {
+	t.Helper()
+	var r struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(resp), &r); err != nil || r.Result == nil {
+		t.Fatalf("no result in %q: %v", resp, err)
+	}
+	if err := json.Unmarshal(r.Result, v); err != nil {
+		t.Fatalf("bad result in %s: %v", resp, err)
+	}
+}
+
+func TestNotificationsNeverAnswered(t *testing.T) {
+	logger := &recordLogger{}
+	s := New()
+	s.Logger = logger
+	s.IgnoreNotifications = false
+	s.Register("a", constHandler(`1`))
+	s.Register("fail", func(context.Context, json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("failed")
+	})
+	var batch []json.RawMessage
+	resp := handle(s, `[{"jsonrpc":"2.0","method":"a","id":1},{"jsonrpc":"2.0","method":"fail"},{"jsonrpc":"2.0","method":"a"}]`)
+	if err := json.Unmarshal([]byte(resp), &batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(batch) != 1 || !strings.Contains(string(batch[0]), `"id":1`) {
+		t.Fatalf("got %s, want only the response to id 1", resp)
+	}
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "fail") {
+		t.Fatalf("got log %q, want the failed notification", logger.lines)
+	}
+}
+
+func TestRegisterWithTimeout(t *testing.T) {
+	s := New()
+	s.RegisterWithTimeout("slow", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, 10*time.Millisecond)
+	s.RegisterWithTimeout("fast", constHandler(`1`), 10*time.Millisecond)
+	if got := handle(s, `{"jsonrpc":"2.0","method":"slow","id":1}`); !strings.Contains(got, fmt.Sprint(ErrCodeTimeout)) {
+		t.Fatalf("slow: got %s, want a timeout", got)
+	}
+	if got := handle(s, `{"jsonrpc":"2.0","method":"fast","id":1}`); !strings.Contains(got, `"result":1`) {
+		t.Fatalf("fast: got %s", got)
+	}
+}
+
+func TestMethodRewriterAliases(t *testing.T) {
+	s := New()
+	s.MethodRewriter = func(method string) string {
+		switch method {
+		case "old.get":
+			return "get"
+		case "removed":
+			return ""
+		}
+		return method
+	}
+	s.Register("get", constHandler(`"new"`))
+	s.Register("removed", constHandler(`"unreachable"`))
+	if got := handle(s, `{"jsonrpc":"2.0","method":"old.get","id":1}`); !strings.Contains(got, `"result":"new"`) {
+		t.Fatalf("alias: got %s", got)
+	}
+	if got := handle(s, `{"jsonrpc":"2.0","method":"removed","id":1}`); !strings.Contains(got, fmt.Sprint(ErrCodeMethodNotFound)) {
+		t.Fatalf("empty rewrite: got %s, want method not found", got)
+	}
+}
+
+func TestErrorTransformer(t *testing.T) {
+	logger := &recordLogger{}
+	s := New()
+	s.Logger = logger
+	s.ErrorTransformer = func(ctx context.Context, method string, err error) error {
+		return NewError(ErrCodeInternalError)
+	}
+	s.Register("db", Wrap(func(ctx context.Context, params *struct{}) (int, error) {
+		return 0, errors.New("password authentication failed for user admin")
+	}))
+	got := handle(s, `{"jsonrpc":"2.0","method":"db","id":1}`)
+	if want := `{"jsonrpc":"2.0","error":{"code":-32603,"message":"Internal error"},"id":1}` + "\n"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "password authentication failed") {
+		t.Fatalf("got log %q, want the original error", logger.lines)
+	}
+}
+
+func TestRegisterWithEncoder(t *testing.T) {
+	s := New()
+	var seen string
+	s.RegisterWithEncoder("a", constHandler(`{"n":1}`), func(result json.RawMessage) (json.RawMessage, error) {
+		seen = string(result)
+		return json.RawMessage(`"encoded"`), nil
+	})
+	s.RegisterWithEncoder("b", constHandler(`1`), func(json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("can't encode")
+	})
+	if got := handle(s, `{"jsonrpc":"2.0","method":"a","id":1}`); !strings.Contains(got, `"result":"encoded"`) || seen != `{"n":1}` {
+		t.Fatalf("got %s, encoder saw %s", got, seen)
+	}
+	if got := handle(s, `{"jsonrpc":"2.0","method":"b","id":1}`); !strings.Contains(got, internalMessages[InternalEncode]) {
+		t.Fatalf("failing encoder: got %s", got)
+	}
+}
+
+// flakyWriter fails every write from the failAt'th (counting from 1) on.
+type flakyWriter struct {
+	failAt, writes int
+	buf            strings.Builder
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes >= w.failAt {
+		return 0, errors.New("connection reset")
+	}
+	return w.buf.Write(p)
+}
+
+func TestWriteBatchStopsOnWriteError(t *testing.T) {
+	s := New()
+	responses := []*rpcResponse{
+		{Jsonrpc: version, Result: json.RawMessage(`1`), Id: json.RawMessage(`1`)},
+		{Jsonrpc: version, Result: json.RawMessage(`2`), Id: json.RawMessage(`2`)},
+		{Jsonrpc: version, Result: json.RawMessage(`3`), Id: json.RawMessage(`3`)},
+	}
+	// the opening bracket, the first response, then the second one fails
+	w := &flakyWriter{failAt: 3}
+	err := s.writeBatch(w, responses)
+	if err == nil || !strings.Contains(err.Error(), "id 2") {
+		t.Fatalf("got error %v, want the failure of id 2", err)
+	}
+	if w.writes != 3 {
+		t.Fatalf("%d writes, want none after the failure", w.writes)
+	}
+	if got, want := w.buf.String(), `[{"jsonrpc":"2.0","result":1,"id":1}`; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestPause(t *testing.T) {
+	s := New()
+	s.Register("a", constHandler(`1`))
+	req := `{"jsonrpc":"2.0","method":"a","id":1}`
+	s.Pause()
+	if got := handle(s, req); !strings.Contains(got, fmt.Sprint(ErrCodeUnavailable)) {
+		t.Fatalf("paused: got %s, want unavailable", got)
+	}
+	s.Resume()
+	if got := handle(s, req); !strings.Contains(got, `"result":1`) {
+		t.Fatalf("resumed: got %s", got)
+	}
+}
+
+func TestMaxParamsDepth(t *testing.T) {
+	s := New()
+	s.MaxParamsDepth = 3
+	called := false
+	s.Register("a", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		called = true
+		return json.RawMessage(`1`), nil
+	})
+	if got := handle(s, `{"jsonrpc":"2.0","method":"a","params":{"a":[{"b":1}]},"id":1}`); !strings.Contains(got, `"result":1`) {
+		t.Fatalf("depth 3: got %s", got)
+	}
+	called = false
+	deep := strings.Repeat("[", 100) + strings.Repeat("]", 100)
+	if got := handle(s, `{"jsonrpc":"2.0","method":"a","params":`+deep+`,"id":1}`); !strings.Contains(got, `"code":-32602`) || called {
+		t.Fatalf("depth 100: got %s, handler called %v", got, called)
+	}
+}
+
+func TestMethodNotFoundFallback(t *testing.T) {
+	fallback := func(next Handler) Handler {
+		return func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+			result, err := next(ctx, params)
+			if errors.Is(err, ErrMethodNotFound) {
+				return json.Marshal("fallback for " + MethodFromContext(ctx))
+			}
+			return result, err
+		}
+	}
+	s := New(WithMiddleware(fallback))
+	s.Register("a", constHandler(`1`))
+	if got := handle(s, `{"jsonrpc":"2.0","method":"a","id":1}`); !strings.Contains(got, `"result":1`) {
+		t.Fatalf("known method: got %s", got)
+	}
+	if got := handle(s, `{"jsonrpc":"2.0","method":"b","id":1}`); !strings.Contains(got, `"result":"fallback for b"`) {
+		t.Fatalf("unknown method: got %s, want the fallback", got)
+	}
+}
+
+func TestLegacyResponses(t *testing.T) {
+	s := New(WithProtocolVersion("1.0"))
+	s.Register("a", constHandler(`1`))
+	for req, want := range map[string]string{
+		`{"method":"a","params":[],"id":1}`:                 `{"result":1,"error":null,"id":1}`,
+		`{"method":"b","params":[],"id":1}`:                 `{"result":null,"error":{"code":-32601,"message":"Method not found"},"id":1}`,
+		`{"jsonrpc":"2.0","method":"a","params":[],"id":2}`: `{"result":1,"error":null,"id":2}`,
+	} {
+		if got := handle(s, req); got != want+"\n" {
+			t.Errorf("%s: got %s, want %s", req, got, want)
+		}
+	}
+}
+
+func TestRegisterAll(t *testing.T) {
+	s := New()
+	handlers := map[string]Handler{}
+	for i := 0; i < 10; i++ {
+		handlers[fmt.Sprint("m", i)] = constHandler(fmt.Sprint(i))
+	}
+	s.RegisterAll(handlers)
+	for i := 0; i < 10; i++ {
+		if got := handle(s, fmt.Sprintf(`{"jsonrpc":"2.0","method":"m%d","id":1}`, i)); !strings.Contains(got, fmt.Sprintf(`"result":%d`, i)) {
+			t.Errorf("m%d: got %s", i, got)
+		}
+	}
+}
+
+func TestOnDroppedNotification(t *testing.T) {
+	var dropped []string
+	s := New()
+	s.OnDroppedNotification = func(method string) {
+		dropped = append(dropped, method)
+	}
+	s.Register("known", constHandler(`1`))
+	handle(s, `{"jsonrpc":"2.0","method":"known"}`)
+	handle(s, `{"jsonrpc":"2.0","method":"unknown"}`)
+	handle(s, `{"jsonrpc":"2.0","method":"unknown2","id":1}`)
+	if len(dropped) != 1 || dropped[0] != "unknown" {
+		t.Fatalf("got %q, want only the unknown notification", dropped)
+	}
+}
+
+type tenantKey struct{}
+
+func TestContextEnricher(t *testing.T) {
+	s := New()
+	s.ContextEnricher = func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, tenantKey{}, "acme")
+	}
+	s.Register("tenant", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		return json.Marshal(tenant)
+	})
+	if got := handle(s, `{"jsonrpc":"2.0","method":"tenant","id":1}`); !strings.Contains(got, `"result":"acme"`) {
+		t.Fatalf("single: got %s", got)
+	}
+	if got := handle(s, `[{"jsonrpc":"2.0","method":"tenant","id":1},{"jsonrpc":"2.0","method":"tenant","id":2}]`); strings.Count(got, `"result":"acme"`) != 2 {
+		t.Fatalf("batch: got %s", got)
+	}
+}
+
+func TestRegisterWithMaxParams(t *testing.T) {
+	s := New()
+	s.RegisterWithMaxParams("small", constHandler(`1`), 16)
+	if got := handle(s, `{"jsonrpc":"2.0","method":"small","params":[1,2,3],"id":1}`); !strings.Contains(got, `"result":1`) {
+		t.Fatalf("small params: got %s", got)
+	}
+	if got := handle(s, `{"jsonrpc":"2.0","method":"small","params":[1,2,3,4,5,6,7,8,9],"id":1}`); !strings.Contains(got, `"code":-32602`) {
+		t.Fatalf("large params: got %s, want invalid params", got)
+	}
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	s := New()
+	s.MaxResponseBytes = 10
+	s.Register("small", constHandler(`"short"`))
+	s.Register("large", constHandler(`"`+strings.Repeat("x", 100)+`"`))
+	if got := handle(s, `{"jsonrpc":"2.0","method":"small","id":1}`); !strings.Contains(got, `"result":"short"`) {
+		t.Fatalf("small result: got %s", got)
+	}
+	want := `{"jsonrpc":"2.0","error":{"code":-32603,"message":"` + internalMessages[InternalTooLarge] + `"},"id":1}` + "\n"
+	if got := handle(s, `{"jsonrpc":"2.0","method":"large","id":1}`); got != want {
+		t.Fatalf("large result: got %s, want %s", got, want)
+	}
+}
+
+func TestRegisterWithMeta(t *testing.T) {
+	logger := &recordLogger{}
+	s := New(WithDeprecationWarnings())
+	s.Logger = logger
+	s.RegisterWithMeta("user.get", constHandler(`1`), MethodMeta{Description: "Get a user", Since: "1.2"})
+	s.RegisterWithMeta("user.fetch", constHandler(`1`), MethodMeta{Description: "Use user.get", Deprecated: true})
+	s.Register("plain", constHandler(`1`))
+	want := map[string]MethodMeta{
+		"user.get":   {Description: "Get a user", Since: "1.2"},
+		"user.fetch": {Description: "Use user.get", Deprecated: true},
+		"plain":      {},
+	}
+	if got := s.Methods(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	handle(s, `{"jsonrpc":"2.0","method":"user.get","id":1}`)
+	if len(logger.lines) != 0 {
+		t.Fatalf("got log %q for a current method", logger.lines)
+	}
+	handle(s, `{"jsonrpc":"2.0","method":"user.fetch","id":1}`)
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "Deprecated method user.fetch") {
+		t.Fatalf("got log %q, want the deprecated call", logger.lines)
+	}
+}
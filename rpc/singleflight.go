@@ -0,0 +1,91 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// SingleflightMiddleware coalesces identical concurrent calls: while a call
+// with the key keyFn returns is running, further calls with that key wait for
+// it instead of running the handler. If it succeeds they all get its result;
+// if it fails each of them runs the handler on its own, so only successful
+// results are shared. An empty key is never coalesced.
+func SingleflightMiddleware(keyFn func(method string, params json.RawMessage) string) Middleware {
+	sf := &singleflight{calls: map[string]*flight{}}
+	return func(next Handler) Handler {
+		return func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+			key := keyFn(MethodFromContext(ctx), params)
+			if key == "" {
+				return next(ctx, params)
+			}
+			f, leader := sf.join(key)
+			if leader {
+				// deferred, so that waiters are released if the handler panics
+				defer sf.finish(key, f)
+				result, err := next(ctx, params)
+				f.result, f.ok = result, err == nil
+				return result, err
+			}
+			select {
+			case <-f.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if !f.ok {
+				return next(ctx, params)
+			}
+			return f.result, nil
+		}
+	}
+}
+
+type singleflight struct {
+	calls map[string]*flight
+	mu    sync.Mutex
+}
+
+type flight struct {
+	done   chan struct{}
+	result json.RawMessage
+	ok     bool
+}
+
+// join returns the call in flight for key, or starts one and reports that
+// the caller leads it.
+func (sf *singleflight) join(key string) (*flight, bool) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	if f, ok := sf.calls[key]; ok {
+		return f, false
+	}
+	f := &flight{done: make(chan struct{})}
+	sf.calls[key] = f
+	return f, true
+}
+
+func (sf *singleflight) finish(key string, f *flight) {
+	sf.mu.Lock()
+	delete(sf.calls, key)
+	sf.mu.Unlock()
+	close(f.done)
+}
@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSingleflightMiddleware(t *testing.T) {
+	s := New(WithMiddleware(SingleflightMiddleware(func(method string, params json.RawMessage) string {
+		return method + string(params)
+	})))
+	var calls atomic.Int32
+	release := make(chan struct{})
+	s.Register("slow", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		calls.Add(1)
+		<-release
+		return json.RawMessage("42"), nil
+	})
+	const n = 20
+	wg := sync.WaitGroup{}
+	responses := make([]string, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = string(s.HandleBytes(context.Background(), []byte(fmt.Sprintf(`{"jsonrpc":"2.0","method":"slow","params":[1],"id":%d}`, i))))
+		}(i)
+	}
+	// wait for all calls to be dispatched, then give them time to join
+	for len(s.InFlight()) < n {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("handler ran %d times, want 1", got)
+	}
+	for i, resp := range responses {
+		if !strings.Contains(resp, `"result":42`) || !strings.Contains(resp, fmt.Sprintf(`"id":%d`, i)) {
+			t.Fatalf("unexpected response %s", resp)
+		}
+	}
+}
+
+func TestSingleflightSharesOnlySuccess(t *testing.T) {
+	s := New(WithMiddleware(SingleflightMiddleware(func(method string, params json.RawMessage) string {
+		return method
+	})))
+	var calls atomic.Int32
+	start := make(chan struct{})
+	s.Register("fail", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		if calls.Add(1) == 1 {
+			<-start
+		}
+		return nil, errors.New("failed")
+	})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.HandleBytes(context.Background(), []byte(`{"jsonrpc":"2.0","method":"fail","id":1}`))
+		}()
+	}
+	for len(s.InFlight()) < 5 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(start)
+	wg.Wait()
+	if got := calls.Load(); got != 5 {
+		t.Fatalf("handler ran %d times, want 5", got)
+	}
+}
@@ -0,0 +1,98 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Stats describes one single request or batch, see RpcServer.OnStats.
+type Stats struct {
+	Batch bool
+	// BytesIn is the number of bytes read for the request.
+	BytesIn int64
+	// BytesOut is the number of bytes written for the response.
+	BytesOut int64
+	// DecodeDuration is the time spent reading and decoding the request.
+	DecodeDuration time.Duration
+}
+
+type statsRecorder struct {
+	r     *RpcServer
+	ctx   context.Context
+	in    *countingReader
+	out   *countingWriter
+	stats Stats
+}
+
+// recordStats wraps reader and writer to count bytes if OnStats is set. The
+// returned recorder is nil otherwise; its methods are no-ops on nil.
+func (r *RpcServer) recordStats(ctx context.Context, reader io.Reader, writer io.Writer, batch bool) (*statsRecorder, io.Reader, io.Writer) {
+	if r.OnStats == nil {
+		return nil, reader, writer
+	}
+	s := &statsRecorder{
+		r:     r,
+		ctx:   ctx,
+		in:    &countingReader{r: reader},
+		out:   &countingWriter{w: writer},
+		stats: Stats{Batch: batch},
+	}
+	return s, s.in, s.out
+}
+
+func (s *statsRecorder) decoded(start time.Time) {
+	if s != nil {
+		s.stats.DecodeDuration = time.Since(start)
+	}
+}
+
+func (s *statsRecorder) done() {
+	if s == nil {
+		return
+	}
+	s.stats.BytesIn = s.in.n
+	s.stats.BytesOut = s.out.n
+	s.r.OnStats(s.ctx, s.stats)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
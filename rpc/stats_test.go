@@ -0,0 +1,35 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestOnStats(t *testing.T) {
+	var stats []Stats
+	s := New()
+	s.OnStats = func(ctx context.Context, st Stats) {
+		stats = append(stats, st)
+	}
+	s.Register("a", constHandler(`"abc"`))
+	single := `{"jsonrpc":"2.0","method":"a","id":1}`
+	batch := `[` + single + `,` + single + `]`
+	out := new(strings.Builder)
+	s.SingleRequest(context.Background(), strings.NewReader(single), out)
+	singleOut := out.Len()
+	s.BatchRequest(context.Background(), strings.NewReader(batch), out)
+	want := []Stats{
+		{BytesIn: int64(len(single)), BytesOut: int64(singleOut)},
+		{Batch: true, BytesIn: int64(len(batch)), BytesOut: int64(out.Len() - singleOut)},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("got %d stats, want %d", len(stats), len(want))
+	}
+	for i := range want {
+		stats[i].DecodeDuration = 0
+		if stats[i] != want[i] {
+			t.Errorf("got %+v, want %+v", stats[i], want[i])
+		}
+	}
+}
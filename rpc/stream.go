@@ -0,0 +1,194 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Serve reads a stream of requests and batches from rw and writes responses
+// back to it. Every top-level JSON value is handled on its own, so single
+// requests (objects) and batches (arrays) may be freely mixed on one stream.
+// Messages are dispatched concurrently, responses are written as they
+// complete. Serve returns nil when the stream ends. Once reading stops, for
+// whatever reason, the contexts of requests still in flight are cancelled
+// and Serve waits for their handlers to return. Each call has its own
+// PerConnRateLimit bucket.
+func (r *RpcServer) Serve(ctx context.Context, rw io.ReadWriter) error {
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(r.enrich(ctx))
+	defer cancel()
+	br := bufio.NewReader(rw)
+	if err := skipBOM(br); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	}
+	dec := json.NewDecoder(br)
+	w := r.timeoutWriter(rw)
+	wmu := sync.Mutex{}
+	ctx = r.withProgress(ctx, func(msg []byte) error {
+		wmu.Lock()
+		defer wmu.Unlock()
+		_, err := w.Write(msg)
+		return err
+	})
+	limit := newTokenBucket(r.PerConnRateLimit)
+	for {
+		var msg json.RawMessage
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				r.log(ctx).Logf("Can't read request: %v", err)
+				wmu.Lock()
+				r.writeError(ErrCodeParseError, w)
+				wmu.Unlock()
+			}
+			return err
+		}
+		if !limit.allow() {
+			wmu.Lock()
+			r.writeRateLimited(ctx, msg, w)
+			wmu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := r.HandleBytes(ctx, msg)
+			if resp == nil {
+				return
+			}
+			if r.ndjson {
+				resp = ndjsonLine(resp)
+			}
+			wmu.Lock()
+			defer wmu.Unlock()
+			if _, err := w.Write(resp); err != nil {
+				r.log(ctx).Logf("Can't write response: %v", err)
+			}
+		}()
+	}
+}
+
+// ListenAndServe accepts connections from l and runs Serve for each of them
+// in its own goroutine. When ctx is cancelled the listener and all open
+// connections are closed; ListenAndServe then returns nil once every
+// connection has finished. If MaxConnections is set, connections beyond the
+// limit get a server busy error, written without blocking further accepts,
+// and are closed.
+func (r *RpcServer) ListenAndServe(ctx context.Context, l net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+	var slots chan struct{}
+	if r.MaxConnections > 0 {
+		slots = make(chan struct{}, r.MaxConnections)
+	}
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			default:
+				r.log(ctx).Logf("Connection limit reached, rejecting %s", conn.RemoteAddr())
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					r.rejectConn(conn)
+				}()
+				continue
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.serveConn(ctx, conn)
+			if slots != nil {
+				<-slots
+			}
+		}()
+	}
+}
+
+// rejectWriteTimeout bounds writing the server busy error to a rejected
+// connection, so peers that don't read can't hold it open.
+const rejectWriteTimeout = time.Second
+
+// rejectConn writes a server busy error to conn and closes it.
+func (r *RpcServer) rejectConn(conn net.Conn) {
+	defer conn.Close()
+	if err := conn.SetWriteDeadline(time.Now().Add(rejectWriteTimeout)); err != nil {
+		return
+	}
+	r.WriteError(ErrCodeServerBusy, conn)
+}
+
+func (r *RpcServer) serveConn(ctx context.Context, conn net.Conn) {
+	ctx = withRemoteAddr(ctx, conn.RemoteAddr().String())
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		_ = conn.Close()
+	}()
+	if err := r.Serve(ctx, conn); err != nil && ctx.Err() == nil {
+		r.log(ctx).Logf("Connection error: %v", err)
+	}
+}
+
+// ndjsonLine returns msg compacted to a single line terminated by a newline,
+// so results with embedded newlines do not break line oriented clients.
+func ndjsonLine(msg []byte) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, len(msg)+1))
+	if err := json.Compact(buf, msg); err != nil {
+		buf.Reset()
+		buf.Write(bytes.TrimRight(msg, "\n"))
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
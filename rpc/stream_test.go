@@ -0,0 +1,263 @@
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func echoServer() *RpcServer {
+	s := New()
+	s.Register("echo", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		return params, nil
+	})
+	return s
+}
+
+func listenAndServe(t *testing.T, s *RpcServer, l net.Listener) (stop func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.ListenAndServe(ctx, l) }()
+	return func() {
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("ListenAndServe: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("ListenAndServe did not return after cancel")
+		}
+	}
+}
+
+func TestListenAndServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("can't listen: %v", err)
+	}
+	stop := listenAndServe(t, echoServer(), l)
+	defer stop()
+	wg := sync.WaitGroup{}
+	for c := 0; c < 2; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			rd := bufio.NewReader(conn)
+			for i := 0; i < 5; i++ {
+				fmt.Fprintf(conn, `{"jsonrpc":"2.0","method":"echo","params":[%d,%d],"id":%d}`, c, i, i)
+				line, err := rd.ReadString('\n')
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if want := fmt.Sprintf(`"result":[%d,%d]`, c, i); !strings.Contains(line, want) {
+					t.Errorf("got %s, want %s", line, want)
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+// pipeListener hands out the server ends of net.Pipe connections.
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "pipe", Net: "pipe"}
+}
+
+// dial returns the client end of a new connection, once it was accepted.
+func (l *pipeListener) dial(t *testing.T) net.Conn {
+	t.Helper()
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not accepted")
+	}
+	return client
+}
+
+func TestMaxConnections(t *testing.T) {
+	s := echoServer()
+	s.MaxConnections = 1
+	l := newPipeListener()
+	stop := listenAndServe(t, s, l)
+	defer stop()
+	first := l.dial(t)
+	defer first.Close()
+	// rejected connections whose peer never reads must not block accepting
+	for i := 0; i < 3; i++ {
+		defer l.dial(t).Close()
+	}
+	rejected := l.dial(t)
+	defer rejected.Close()
+	line, err := bufio.NewReader(rejected).ReadString('\n')
+	if err != nil || !strings.Contains(line, fmt.Sprint(ErrCodeServerBusy)) {
+		t.Fatalf("got %q, %v, want server busy", line, err)
+	}
+	fmt.Fprint(first, `{"jsonrpc":"2.0","method":"echo","params":[1],"id":1}`)
+	line, err = bufio.NewReader(first).ReadString('\n')
+	if err != nil || !strings.Contains(line, `"result":[1]`) {
+		t.Fatalf("got %q, %v", line, err)
+	}
+}
+
+// serve runs Serve over in and returns what it wrote.
+func serve(t *testing.T, s *RpcServer, in string) string {
+	t.Helper()
+	out := new(bytes.Buffer)
+	if err := s.Serve(context.Background(), struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(in), out}); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	return out.String()
+}
+
+func TestServeMixedStream(t *testing.T) {
+	out := serve(t, echoServer(), `{"jsonrpc":"2.0","method":"echo","params":[1],"id":1}
+[{"jsonrpc":"2.0","method":"echo","params":[2],"id":2},{"jsonrpc":"2.0","method":"echo","params":[3],"id":3}]
+{"jsonrpc":"2.0","method":"echo","params":[4],"id":4}`)
+	dec := json.NewDecoder(strings.NewReader(out))
+	singles, batches := 0, 0
+	for {
+		var msg json.RawMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("%v in %s", err, out)
+		}
+		var batch []json.RawMessage
+		if json.Unmarshal(msg, &batch) == nil {
+			if len(batch) != 2 {
+				t.Errorf("batch response %s, want 2 responses", msg)
+			}
+			batches++
+		} else {
+			singles++
+		}
+	}
+	if singles != 2 || batches != 1 {
+		t.Fatalf("got %d single and %d batch responses in %s, want 2 and 1", singles, batches, out)
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	s := New(WithNDJSON())
+	s.Register("text", constHandler("{\n  \"text\": \"a\\nb\"\n}"))
+	out := serve(t, s, `{"jsonrpc":"2.0","method":"text","id":1}
+[{"jsonrpc":"2.0","method":"text","id":2},{"jsonrpc":"2.0","method":"text","id":3}]
+{"jsonrpc":"2.0","method":"missing","id":4}`)
+	if !strings.HasSuffix(out, "\n") {
+		t.Fatalf("output %q not newline terminated", out)
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines in %q, want one per message", len(lines), out)
+	}
+	for _, line := range lines {
+		if !json.Valid([]byte(line)) {
+			t.Errorf("line %q is not a JSON value", line)
+		}
+	}
+}
+
+func TestServeCancelsOnClose(t *testing.T) {
+	s := New()
+	started := make(chan struct{}, 2)
+	var cancelled atomic.Int32
+	s.Register("slow", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		cancelled.Add(1)
+		return nil, ctx.Err()
+	})
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(context.Background(), struct {
+			io.Reader
+			io.Writer
+		}{pr, io.Discard})
+	}()
+	fmt.Fprint(pw, `{"jsonrpc":"2.0","method":"slow","id":1}{"jsonrpc":"2.0","method":"slow","id":2}`)
+	for i := 0; i < 2; i++ {
+		<-started
+	}
+	pw.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after the reader closed")
+	}
+	if n := cancelled.Load(); n != 2 {
+		t.Fatalf("%d handlers saw cancellation, want 2", n)
+	}
+}
+
+func TestRemoteAddrLogged(t *testing.T) {
+	logger := &recordLogger{}
+	s := New()
+	s.Logger = logger
+	s.Register("fail", func(context.Context, json.RawMessage) (json.RawMessage, error) {
+		return nil, fmt.Errorf("failed")
+	})
+	l := newPipeListener()
+	stop := listenAndServe(t, s, l)
+	conn := l.dial(t)
+	fmt.Fprint(conn, `{"jsonrpc":"2.0","method":"fail","id":1}`)
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	stop()
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if len(logger.lines) == 0 || !strings.Contains(logger.lines[0], "[remote=pipe]") || !strings.Contains(logger.lines[0], "failed") {
+		t.Fatalf("got log %q, want the error with the remote address", logger.lines)
+	}
+}
@@ -0,0 +1,81 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TimeLayout gives the layout a CustomTime is parsed and formatted with, e.g.
+//
+//	type kitchen struct{}
+//
+//	func (kitchen) Layout() string { return time.Kitchen }
+//
+// Being part of the type, different fields, packages and goroutines can use
+// different layouts.
+type TimeLayout interface {
+	Layout() string
+}
+
+// RFC3339 is the TimeLayout of time.RFC3339.
+type RFC3339 struct{}
+
+func (RFC3339) Layout() string { return time.RFC3339 }
+
+// DateTime is the TimeLayout of time.DateTime.
+type DateTime struct{}
+
+func (DateTime) Layout() string { return time.DateTime }
+
+// DateOnly is the TimeLayout of time.DateOnly.
+type DateOnly struct{}
+
+func (DateOnly) Layout() string { return time.DateOnly }
+
+// CustomTime is a time.Time encoded in JSON as a string in the layout given by
+// L, e.g. CustomTime[DateTime]. Use it for params fields with timestamps that
+// are not RFC 3339.
+type CustomTime[L TimeLayout] struct {
+	time.Time
+}
+
+func (t *CustomTime[L]) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	var layout L
+	parsed, err := time.Parse(layout.Layout(), s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+func (t CustomTime[L]) MarshalJSON() ([]byte, error) {
+	var layout L
+	return json.Marshal(t.Format(layout.Layout()))
+}
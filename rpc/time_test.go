@@ -0,0 +1,41 @@
+package rpc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCustomTime(t *testing.T) {
+	var params struct {
+		At  CustomTime[DateTime] `json:"at"`
+		On  CustomTime[DateOnly] `json:"on"`
+		Std CustomTime[RFC3339]  `json:"std"`
+	}
+	in := `{"at":"2024-03-01 12:30:00","on":"2024-03-02","std":"2024-03-03T01:02:03Z"}`
+	if err := json.Unmarshal([]byte(in), &params); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		got  time.Time
+		want time.Time
+	}{
+		{params.At.Time, time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)},
+		{params.On.Time, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{params.Std.Time, time.Date(2024, 3, 3, 1, 2, 3, 0, time.UTC)},
+	} {
+		if !tc.got.Equal(tc.want) {
+			t.Errorf("got %v, want %v", tc.got, tc.want)
+		}
+	}
+	out, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Fatalf("got %s, want %s", out, in)
+	}
+	if err := json.Unmarshal([]byte(`{"at":"2024-03-01T12:30:00Z"}`), &params); err == nil {
+		t.Fatal("expected an error for a time in another layout")
+	}
+}
@@ -0,0 +1,137 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ReplyFunc delivers a response for a received message.
+type ReplyFunc func(resp []byte) error
+
+// Transport is a message oriented transport, e.g. a message queue subscription
+// where every message holds one request or batch. Receive blocks until the
+// next message is available and returns io.EOF when there are no more.
+type Transport interface {
+	Receive() ([]byte, ReplyFunc, error)
+}
+
+// HandleBytes dispatches a raw request or batch and returns the encoded
+// response. It returns nil if there is nothing to reply. Panics while
+// handling raw, in handlers or in hooks like MethodRewriter or
+// ErrorTransformer, are logged and answered with an InternalPanic error, also
+// for batch members.
+func (r *RpcServer) HandleBytes(ctx context.Context, raw []byte) (resp []byte) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			r.log(ctx).Logf("Panic while handling request: %v", rec)
+			buf := new(bytes.Buffer)
+			r.writeErrorResponse(r.internalError(InternalPanic), nil, buf)
+			resp = buf.Bytes()
+		}
+	}()
+	raw = trimBOM(raw)
+	buf := new(bytes.Buffer)
+	if isBatch(raw) {
+		r.BatchRequest(ctx, bytes.NewReader(raw), buf)
+	} else {
+		r.SingleRequest(ctx, bytes.NewReader(raw), buf)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// HandleBytesStream is HandleBytes for clients that want batch responses one
+// by one: emit is called with every encoded response, without a trailing
+// newline, as soon as it is ready, in completion order. A single request
+// gets its only response the same way. emit is never called concurrently.
+// OnStats and WithRecorder do not see requests handled this way.
+func (r *RpcServer) HandleBytesStream(ctx context.Context, raw []byte, emit func(resp []byte)) {
+	raw = trimBOM(raw)
+	ctx = r.enrich(ctx)
+	if !isBatch(raw) {
+		if resp := r.HandleBytes(ctx, raw); resp != nil {
+			emit(bytes.TrimRight(resp, "\n"))
+		}
+		return
+	}
+	batch, err := splitBatch(raw)
+	if err != nil || len(batch) == 0 {
+		code := ErrCodeInvalidRequest
+		if err != nil {
+			r.log(ctx).Logf("Can't read body: %v", err)
+			code = ErrCodeParseError
+		}
+		buf := new(bytes.Buffer)
+		r.writeError(code, buf)
+		emit(bytes.TrimRight(buf.Bytes(), "\n"))
+		return
+	}
+	r.streamBatch(withBatchID(ctx, r.newID()), batch, func(resp *rpcResponse) {
+		b, err := json.Marshal(resp)
+		if err != nil {
+			r.log(ctx).Logf("Can't marshal response: %v", err)
+			if b, err = json.Marshal(rpcResponse{
+				Jsonrpc: r.responseVersion(),
+				Error:   r.internalError(InternalMarshal),
+				Id:      resp.Id,
+			}); err != nil {
+				return
+			}
+		}
+		emit(b)
+	})
+}
+
+// ServeTransport receives messages from t and dispatches each of them
+// concurrently, replying through the message ReplyFunc. It returns nil when t
+// is exhausted or ctx is done, after in-flight messages complete.
+func (r *RpcServer) ServeTransport(ctx context.Context, t Transport) error {
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	for ctx.Err() == nil {
+		msg, reply, err := t.Receive()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := r.HandleBytes(ctx, msg)
+			if resp == nil {
+				return
+			}
+			if err := reply(resp); err != nil {
+				r.log(ctx).Logf("Can't write response: %v", err)
+			}
+		}()
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func fuzzServer() *RpcServer {
+	s := New(WithClientTimeouts(0), WithStrictParamsType())
+	s.MaxParamsDepth = 8
+	s.MaxPerBatch = map[string]int{"echo": 2}
+	s.Register("echo", func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		return params, nil
+	})
+	s.Register("sum", Wrap(func(ctx context.Context, params *[]int) (int, error) {
+		sum := 0
+		for _, n := range *params {
+			sum += n
+		}
+		return sum, nil
+	}))
+	return s
+}
+
+func FuzzHandle(f *testing.F) {
+	for _, seed := range []string{
+		`{"jsonrpc":"2.0","method":"sum","params":[1,2],"id":1}`,
+		`{"jsonrpc":"2.0","method":"echo","params":{"a":[1,{"b":null}]},"id":"x"}`,
+		`{"jsonrpc":"2.0","method":"echo"}`,
+		`[{"jsonrpc":"2.0","method":"sum","params":[1],"id":1},{"jsonrpc":"2.0","method":"echo","id":2},{"jsonrpc":"2.0","method":"nope","id":3}]`,
+		`[{"jsonrpc":"2.0","method":"echo","id":1},{"jsonrpc":"2.0","method":"echo","id":2},{"jsonrpc":"2.0","method":"echo","id":3}]`,
+		`[1,2,3]`,
+		`[]`,
+		`{"jsonrpc":"2.0","method":"sum","params":"bar","id":1,"timeout_ms":-1}`,
+		`{"jsonrpc":"2.0","method":"sum","params":[1,2`,
+		`[{"jsonrpc":"2.0","method":"sum","params":[1]},{"jsonrpc"`,
+		"\xef\xbb\xbf{\"jsonrpc\":\"2.0\",\"method\":\"sum\",\"params\":[],\"id\":1}",
+		`null`,
+		``,
+	} {
+		f.Add([]byte(seed))
+	}
+	s := fuzzServer()
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		resp := s.HandleBytes(context.Background(), raw)
+		if resp != nil && !json.Valid(resp) {
+			t.Fatalf("invalid JSON response to %q: %q", raw, resp)
+		}
+	})
+}
+
+func TestHookPanicInBatch(t *testing.T) {
+	s := fuzzServer()
+	s.MethodRewriter = func(method string) string {
+		if method == "boom" {
+			panic("boom")
+		}
+		return method
+	}
+	resp := s.HandleBytes(context.Background(), []byte(`[{"jsonrpc":"2.0","method":"boom","id":1},{"jsonrpc":"2.0","method":"sum","params":[2],"id":2}]`))
+	if !strings.Contains(string(resp), `"code":-32603`) || !strings.Contains(string(resp), `"result":2`) {
+		t.Fatalf("unexpected response %s", resp)
+	}
+}
+
+// fakeTransport delivers msgs, then io.EOF, and collects the replies.
+type fakeTransport struct {
+	msgs    []string
+	mu      sync.Mutex
+	replies []string
+}
+
+func (f *fakeTransport) Receive() ([]byte, ReplyFunc, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.msgs) == 0 {
+		return nil, nil, io.EOF
+	}
+	msg := f.msgs[0]
+	f.msgs = f.msgs[1:]
+	return []byte(msg), func(resp []byte) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.replies = append(f.replies, string(resp))
+		return nil
+	}, nil
+}
+
+func TestServeTransport(t *testing.T) {
+	tr := &fakeTransport{msgs: []string{
+		`{"jsonrpc":"2.0","method":"sum","params":[1,2],"id":1}`,
+		`{"jsonrpc":"2.0","method":"sum","params":[3,4],"id":2}`,
+	}}
+	if err := fuzzServer().ServeTransport(context.Background(), tr); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(tr.replies)
+	want := []string{
+		`{"jsonrpc":"2.0","result":3,"id":1}` + "\n",
+		`{"jsonrpc":"2.0","result":7,"id":2}` + "\n",
+	}
+	if strings.Join(tr.replies, "") != strings.Join(want, "") {
+		t.Fatalf("got replies %q, want %q", tr.replies, want)
+	}
+}
@@ -0,0 +1,128 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Validate checks that raw is a well-formed request (or batch) for a
+// registered method, with params within the limits dispatch enforces, without
+// executing any handler. raw is decoded exactly as HandleBytes decodes it. It
+// returns the first Error found or nil.
+func (r *RpcServer) Validate(ctx context.Context, raw []byte) error {
+	raw = trimBOM(raw)
+	if isBatch(raw) {
+		batch, err := splitBatch(raw)
+		if err != nil {
+			return NewError(ErrCodeParseError)
+		}
+		if len(batch) == 0 {
+			return NewError(ErrCodeInvalidRequest)
+		}
+		for _, raw := range batch {
+			if err := r.validateRequest(ctx, raw); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// like SingleRequest, only the first JSON value counts
+	var req json.RawMessage
+	if err := json.NewDecoder(bytes.NewReader(raw)).Decode(&req); err != nil {
+		return NewError(ErrCodeParseError)
+	}
+	return r.validateRequest(ctx, req)
+}
+
+func (r *RpcServer) validateRequest(_ context.Context, raw json.RawMessage) error {
+	req := new(rpcRequest)
+	if err := json.Unmarshal(raw, req); err != nil {
+		return NewError(ErrCodeInvalidRequest)
+	}
+	if err := r.checkRequest(req); err != nil {
+		return NewError(ErrCodeInvalidRequest)
+	}
+	// same order as callMethod: params are checked before the method
+	m, ok := r.lookup(req.Method)
+	if err := r.checkParams(req, m); err != nil {
+		return NewError(ErrCodeInvalidParams)
+	}
+	if !ok {
+		return NewError(ErrCodeMethodNotFound)
+	}
+	return nil
+}
+
+// checkRequest validates the request object members required by the spec.
+// In 1.0 mode the jsonrpc member is not checked.
+func (r *RpcServer) checkRequest(req *rpcRequest) error {
+	switch {
+	case !r.legacy && req.Jsonrpc != version:
+		return errors.New("jsonrpc member must be exactly \"2.0\"")
+	case req.Method == "":
+		return errors.New("method member is missing")
+	case !validId(req.Id):
+		return errors.New("id member must be a string, number or null")
+	}
+	return nil
+}
+
+// checkParams applies the params limits the server and m set before the
+// handler runs: WithStrictParamsType, RegisterWithMaxParams and
+// MaxParamsDepth.
+func (r *RpcServer) checkParams(req *rpcRequest, m methodEntry) error {
+	switch {
+	case r.strictParamsType && !structuredParams(req.Params):
+		return fmt.Errorf("params of %s are not an array or object", req.Method)
+	case m.maxParams > 0 && len(req.Params) > m.maxParams:
+		return fmt.Errorf("params of %s too large", req.Method)
+	case r.MaxParamsDepth > 0 && paramsDepth(req.Params) > r.MaxParamsDepth:
+		return fmt.Errorf("params of %s nested too deep", req.Method)
+	}
+	return nil
+}
+
+func validId(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	// numbers are not converted, ids beyond float64 range are fine too
+	dec := json.NewDecoder(bytes.NewReader(id))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return false
+	}
+	switch v.(type) {
+	case nil, string, json.Number:
+		return true
+	}
+	return false
+}
+
+func isBatch(raw []byte) bool {
+	raw = bytes.TrimLeft(raw, " \t\r\n")
+	return len(raw) > 0 && raw[0] == '['
+}
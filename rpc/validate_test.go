@@ -0,0 +1,76 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestValidateMatchesDispatch(t *testing.T) {
+	s := New(WithStrictParamsType())
+	s.MaxParamsDepth = 2
+	echo := func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		return params, nil
+	}
+	s.Register("echo", echo)
+	s.RegisterWithMaxParams("small", echo, 10)
+	for req, code := range map[string]int{
+		`{"jsonrpc":"2.0","method":"echo","params":[1],"id":1}`:                                                         0,
+		`{"jsonrpc":"2.0","method":"echo","params":5,"id":1}`:                                                           ErrCodeInvalidParams,
+		`{"jsonrpc":"2.0","method":"echo","params":[[[1]]],"id":1}`:                                                     ErrCodeInvalidParams,
+		`{"jsonrpc":"2.0","method":"small","params":[1,2,3,4,5,6,7],"id":1}`:                                            ErrCodeInvalidParams,
+		`{"jsonrpc":"2.0","method":"missing","id":1}`:                                                                   ErrCodeMethodNotFound,
+		`[{"jsonrpc":"2.0","method":"echo","params":[1],"id":1},{"jsonrpc":"2.0","method":"echo","params":"x","id":2}]`: ErrCodeInvalidParams,
+	} {
+		err := s.Validate(context.Background(), []byte(req))
+		got := 0
+		if e, ok := err.(Error); ok {
+			got = e.Code
+		} else if err != nil {
+			t.Fatalf("%s: unexpected error %v", req, err)
+		}
+		if got != code {
+			t.Errorf("%s: got code %d, want %d", req, got, code)
+		}
+	}
+}
+
+func TestValidateDecodesLikeDispatch(t *testing.T) {
+	s := New()
+	s.Register("raw", constHandler(`1`))
+	for _, req := range []string{
+		`{"jsonrpc":"2.0","method":"raw","id":1} garbage`,
+		`{"jsonrpc":"2.0","method":"raw","id":1}{"jsonrpc":"2.0","method":"raw","id":2}`,
+		`[{"jsonrpc":"2.0","method":"raw","id":1}] garbage`,
+		"\ufeff" + `{"jsonrpc":"2.0","method":"raw","id":1}`,
+		`{"jsonrpc":"2.0","method":"raw","id":1`,
+		`[`,
+		`[]`,
+	} {
+		var resp struct {
+			Error *Error `json:"error"`
+		}
+		out := s.HandleBytes(context.Background(), []byte(req))
+		if len(out) > 0 && out[0] == '[' {
+			var batch []json.RawMessage
+			if err := json.Unmarshal(out, &batch); err != nil {
+				t.Fatal(err)
+			}
+			out = batch[0]
+		}
+		if err := json.Unmarshal(out, &resp); err != nil {
+			t.Fatalf("%s: %v", req, err)
+		}
+		want := 0
+		if resp.Error != nil {
+			want = resp.Error.Code
+		}
+		got := 0
+		if e, ok := s.Validate(context.Background(), []byte(req)).(Error); ok {
+			got = e.Code
+		}
+		if got != want {
+			t.Errorf("%s: Validate got code %d, dispatch %d", req, got, want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import "encoding/json"
+
+// WarningsResult is a successful result carrying non-fatal warnings. It is
+// encoded as {"value": <result>, "warnings": ["...", ...]}.
+type WarningsResult struct {
+	Value    any      `json:"value"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ResultWithWarnings wraps result with warnings. Return it from a wrapped
+// handler to report a best-effort result.
+func ResultWithWarnings(result any, warnings ...string) WarningsResult {
+	return WarningsResult{
+		Value:    result,
+		Warnings: warnings,
+	}
+}
+
+// UnwrapWarnings decodes a result produced by ResultWithWarnings into v and
+// returns its warnings.
+func UnwrapWarnings(raw json.RawMessage, v any) ([]string, error) {
+	var res struct {
+		Value    json.RawMessage `json:"value"`
+		Warnings []string        `json:"warnings"`
+	}
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(res.Value, v); err != nil {
+		return nil, err
+	}
+	return res.Warnings, nil
+}
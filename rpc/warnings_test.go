@@ -0,0 +1,29 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestWarningsRoundTrip(t *testing.T) {
+	s := New()
+	s.Register("partial", Wrap(func(ctx context.Context, params *struct{}) (WarningsResult, error) {
+		return ResultWithWarnings([]int{1, 2}, "shard 3 unavailable"), nil
+	}))
+	var r struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(handle(s, `{"jsonrpc":"2.0","method":"partial","id":1}`)), &r); err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	warnings, err := UnwrapWarnings(r.Result, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []int{1, 2}) || !reflect.DeepEqual(warnings, []string{"shard 3 unavailable"}) {
+		t.Fatalf("got %v with warnings %q", got, warnings)
+	}
+}
@@ -20,6 +20,7 @@
 package rpc
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 )
@@ -27,18 +28,75 @@ import (
 func Wrap[RQ any, RS any](handler func(context.Context, *RQ) (RS, error)) Handler {
 	return func(ctx context.Context, in json.RawMessage) (json.RawMessage, error) {
 		req := new(RQ)
-		if err := json.Unmarshal(in, req); err != nil {
-			return nil, NewError(ErrCodeParseError)
+		if d, ok := any(req).(Defaulter); ok {
+			d.Defaults()
+		}
+		if err := decodeParams(ctx, in, req); err != nil {
+			return nil, err
 		}
 		resp, err := handler(ctx, req)
 		if err != nil {
-			return nil, Error{
-				Code:    ErrUser,
-				Message: err.Error(),
-			}
+			return nil, handlerError(err)
+		}
+		return encodeResult(ctx, resp)
+	}
+}
+
+// Wrap2 is like Wrap for handlers with two results. They are sent as members
+// name1 and name2 of the result object.
+func Wrap2[RQ any, RS1 any, RS2 any](name1, name2 string, handler func(context.Context, *RQ) (RS1, RS2, error)) Handler {
+	return func(ctx context.Context, in json.RawMessage) (json.RawMessage, error) {
+		req := new(RQ)
+		if d, ok := any(req).(Defaulter); ok {
+			d.Defaults()
+		}
+		if err := decodeParams(ctx, in, req); err != nil {
+			return nil, err
+		}
+		resp1, resp2, err := handler(ctx, req)
+		if err != nil {
+			return nil, handlerError(err)
 		}
-		return json.Marshal(resp)
+		return encodeResult(ctx, map[string]any{
+			name1: resp1,
+			name2: resp2,
+		})
 	}
 }
 
 type Handler func(context.Context, json.RawMessage) (json.RawMessage, error)
+
+// Middleware wraps a Handler. Middlewares installed with WithMiddleware wrap
+// every registered handler; the method being called is available from
+// MethodFromContext.
+type Middleware func(next Handler) Handler
+
+// Defaulter may be implemented (on the pointer) by params types of wrapped
+// handlers. Defaults is called before params are decoded, so fields sent by
+// the client override the defaults.
+type Defaulter interface {
+	Defaults()
+}
+
+type strictParamsKey struct{}
+
+// decodeParams decodes params of wrapped handlers into v. Params that don't
+// match v, and unknown fields if the server uses WithStrictParams, are
+// rejected with Invalid params. Omitted params leave v as is, like null.
+func decodeParams(ctx context.Context, params json.RawMessage, v any) error {
+	if params == nil {
+		return nil
+	}
+	if strict, _ := ctx.Value(strictParamsKey{}).(bool); strict {
+		dec := json.NewDecoder(bytes.NewReader(params))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(v); err != nil {
+			return NewError(ErrCodeInvalidParams)
+		}
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return NewError(ErrCodeInvalidParams)
+	}
+	return nil
+}
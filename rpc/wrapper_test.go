@@ -0,0 +1,83 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type point struct {
+	X, Y int
+}
+
+func pointServer(opts ...Option) *RpcServer {
+	s := New(opts...)
+	s.Register("sum", Wrap(func(ctx context.Context, p *point) (int, error) {
+		return p.X + p.Y, nil
+	}))
+	return s
+}
+
+func TestStrictParams(t *testing.T) {
+	lenient, strict := pointServer(), pointServer(WithStrictParams())
+	for _, tc := range []struct {
+		params                string
+		lenientOut, strictOut string
+	}{
+		{`{"X":1,"Y":2}`, `"result":3`, `"result":3`},
+		{`{"X":1,"Y":2,"Z":3}`, `"result":3`, `"code":-32602`},
+		{`{"X":"one"}`, `"code":-32602`, `"code":-32602`},
+		{`[1,2]`, `"code":-32602`, `"code":-32602`},
+	} {
+		req := `{"jsonrpc":"2.0","method":"sum","params":` + tc.params + `,"id":1}`
+		if got := handle(lenient, req); !strings.Contains(got, tc.lenientOut) {
+			t.Errorf("lenient %s: got %s, want %s", tc.params, got, tc.lenientOut)
+		}
+		if got := handle(strict, req); !strings.Contains(got, tc.strictOut) {
+			t.Errorf("strict %s: got %s, want %s", tc.params, got, tc.strictOut)
+		}
+	}
+}
+
+type pageParams struct {
+	Page, Size int
+}
+
+func (p *pageParams) Defaults() {
+	p.Size = 20
+}
+
+func TestDefaulter(t *testing.T) {
+	s := New()
+	s.Register("page", Wrap(func(ctx context.Context, p *pageParams) (pageParams, error) {
+		return *p, nil
+	}))
+	for params, want := range map[string]pageParams{
+		`{"Page":2}`:          {Page: 2, Size: 20},
+		`{"Page":2,"Size":5}`: {Page: 2, Size: 5},
+		`null`:                {Size: 20},
+	} {
+		var got pageParams
+		decodeResult(t, handle(s, `{"jsonrpc":"2.0","method":"page","params":`+params+`,"id":1}`), &got)
+		if got != want {
+			t.Errorf("%s: got %+v, want %+v", params, got, want)
+		}
+	}
+}
+
+func TestWrap2(t *testing.T) {
+	s := New()
+	s.Register("divmod", Wrap2("quotient", "remainder", func(ctx context.Context, p *point) (int, int, error) {
+		if p.Y == 0 {
+			return 0, 0, errors.New("division by zero")
+		}
+		return p.X / p.Y, p.X % p.Y, nil
+	}))
+	if got, want := handle(s, `{"jsonrpc":"2.0","method":"divmod","params":{"X":7,"Y":2},"id":1}`), `{"jsonrpc":"2.0","result":{"quotient":3,"remainder":1},"id":1}`+"\n"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if got := handle(s, `{"jsonrpc":"2.0","method":"divmod","params":{"X":7},"id":1}`); !strings.Contains(got, `"message":"division by zero"`) {
+		t.Fatalf("got %s, want the handler error", got)
+	}
+}
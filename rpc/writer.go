@@ -0,0 +1,59 @@
+//Package rpc provides abstract rpc server
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"io"
+	"time"
+)
+
+type deadlineSetter interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// timeoutWriter bounds every write to w by WriteTimeout if w has write
+// deadlines, e.g. a net.Conn. Other writers, like in-memory buffers, are
+// returned as is; transports over them set their own deadlines (see the http
+// package).
+func (r *RpcServer) timeoutWriter(w io.Writer) io.Writer {
+	if r.WriteTimeout <= 0 {
+		return w
+	}
+	switch tw := w.(type) {
+	case *deadlineWriter:
+		return w
+	case deadlineSetter:
+		return &deadlineWriter{w: w, conn: tw, timeout: r.WriteTimeout}
+	}
+	return w
+}
+
+type deadlineWriter struct {
+	w       io.Writer
+	conn    deadlineSetter
+	timeout time.Duration
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	if err := d.conn.SetWriteDeadline(time.Now().Add(d.timeout)); err != nil {
+		return 0, err
+	}
+	return d.w.Write(p)
+}
@@ -0,0 +1,40 @@
+package rpc
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTimeoutWriterLeavesBuffers(t *testing.T) {
+	s := New()
+	s.WriteTimeout = time.Second
+	buf := new(bytes.Buffer)
+	if w := s.timeoutWriter(buf); w != buf {
+		t.Fatalf("buffer wrapped in %T", w)
+	}
+}
+
+func TestTimeoutWriterConn(t *testing.T) {
+	s := New()
+	s.WriteTimeout = 50 * time.Millisecond
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	w := s.timeoutWriter(server)
+	if s.timeoutWriter(w) != w {
+		t.Fatal("conn wrapped twice")
+	}
+	start := time.Now()
+	// nobody reads from client
+	_, err := w.Write([]byte("{}"))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("got %v, want deadline exceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("write took %v", d)
+	}
+}
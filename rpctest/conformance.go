@@ -0,0 +1,243 @@
+//Package rpctest provides utilities for testing JSON-RPC 2.0 servers
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpctest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"go.neonxp.dev/jsonrpc2/rpc"
+)
+
+// RegisterSpecMethods registers the methods used by the examples of the
+// JSON-RPC 2.0 specification: subtract, sum, update, notify_hello and
+// get_data. Servers checked with ConformanceTest must have them registered.
+func RegisterSpecMethods(r *rpc.RpcServer) {
+	r.Register("subtract", subtract)
+	r.Register("sum", rpc.Wrap(func(_ context.Context, args *[]int) (int, error) {
+		sum := 0
+		for _, a := range *args {
+			sum += a
+		}
+		return sum, nil
+	}))
+	r.Register("update", rpc.Wrap(func(_ context.Context, _ *[]int) (any, error) {
+		return nil, nil
+	}))
+	r.Register("notify_hello", rpc.Wrap(func(_ context.Context, _ *[]int) (any, error) {
+		return nil, nil
+	}))
+	r.Register("get_data", func(_ context.Context, _ json.RawMessage) (json.RawMessage, error) {
+		return json.Marshal([]any{"hello", 5})
+	})
+}
+
+// subtract accepts both positional and named params, as in the spec examples.
+func subtract(_ context.Context, params json.RawMessage) (json.RawMessage, error) {
+	var positional []int
+	if err := json.Unmarshal(params, &positional); err == nil && len(positional) == 2 {
+		return json.Marshal(positional[0] - positional[1])
+	}
+	var named struct {
+		Minuend    *int `json:"minuend"`
+		Subtrahend *int `json:"subtrahend"`
+	}
+	if err := json.Unmarshal(params, &named); err != nil || named.Minuend == nil || named.Subtrahend == nil {
+		return nil, rpc.NewError(rpc.ErrCodeInvalidParams)
+	}
+	return json.Marshal(*named.Minuend - *named.Subtrahend)
+}
+
+var specExamples = []struct {
+	name     string
+	request  string
+	response string
+}{
+	{
+		name:     "positional params",
+		request:  `{"jsonrpc": "2.0", "method": "subtract", "params": [42, 23], "id": 1}`,
+		response: `{"jsonrpc": "2.0", "result": 19, "id": 1}`,
+	},
+	{
+		name:     "positional params reversed",
+		request:  `{"jsonrpc": "2.0", "method": "subtract", "params": [23, 42], "id": 2}`,
+		response: `{"jsonrpc": "2.0", "result": -19, "id": 2}`,
+	},
+	{
+		name:     "named params",
+		request:  `{"jsonrpc": "2.0", "method": "subtract", "params": {"subtrahend": 23, "minuend": 42}, "id": 3}`,
+		response: `{"jsonrpc": "2.0", "result": 19, "id": 3}`,
+	},
+	{
+		name:     "named params reordered",
+		request:  `{"jsonrpc": "2.0", "method": "subtract", "params": {"minuend": 42, "subtrahend": 23}, "id": 4}`,
+		response: `{"jsonrpc": "2.0", "result": 19, "id": 4}`,
+	},
+	{
+		name:    "notification",
+		request: `{"jsonrpc": "2.0", "method": "update", "params": [1,2,3,4,5]}`,
+	},
+	{
+		name:    "notification of unknown method",
+		request: `{"jsonrpc": "2.0", "method": "foobar"}`,
+	},
+	{
+		name:     "non-existent method",
+		request:  `{"jsonrpc": "2.0", "method": "foobar", "id": "1"}`,
+		response: `{"jsonrpc": "2.0", "error": {"code": -32601, "message": "Method not found"}, "id": "1"}`,
+	},
+	{
+		name:     "invalid JSON",
+		request:  `{"jsonrpc": "2.0", "method": "foobar, "params": "bar", "baz]`,
+		response: `{"jsonrpc": "2.0", "error": {"code": -32700, "message": "Parse error"}, "id": null}`,
+	},
+	{
+		name:     "invalid request object",
+		request:  `{"jsonrpc": "2.0", "method": 1, "params": "bar"}`,
+		response: `{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}`,
+	},
+	{
+		name: "batch with invalid JSON",
+		request: `[
+  {"jsonrpc": "2.0", "method": "sum", "params": [1,2,4], "id": "1"},
+  {"jsonrpc": "2.0", "method"
+]`,
+		response: `{"jsonrpc": "2.0", "error": {"code": -32700, "message": "Parse error"}, "id": null}`,
+	},
+	{
+		name:     "empty batch",
+		request:  `[]`,
+		response: `{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}`,
+	},
+	{
+		name:     "invalid batch",
+		request:  `[1]`,
+		response: `[{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}]`,
+	},
+	{
+		name:    "invalid batch of three",
+		request: `[1,2,3]`,
+		response: `[
+  {"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null},
+  {"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null},
+  {"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}
+]`,
+	},
+	{
+		name: "batch",
+		request: `[
+  {"jsonrpc": "2.0", "method": "sum", "params": [1,2,4], "id": "1"},
+  {"jsonrpc": "2.0", "method": "notify_hello", "params": [7]},
+  {"jsonrpc": "2.0", "method": "subtract", "params": [42,23], "id": "2"},
+  {"foo": "boo"},
+  {"jsonrpc": "2.0", "method": "foo.get", "params": {"name": "myself"}, "id": "5"},
+  {"jsonrpc": "2.0", "method": "get_data", "id": "9"}
+]`,
+		response: `[
+  {"jsonrpc": "2.0", "result": 7, "id": "1"},
+  {"jsonrpc": "2.0", "result": 19, "id": "2"},
+  {"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null},
+  {"jsonrpc": "2.0", "error": {"code": -32601, "message": "Method not found"}, "id": "5"},
+  {"jsonrpc": "2.0", "result": ["hello", 5], "id": "9"}
+]`,
+	},
+	{
+		name: "batch of notifications",
+		request: `[
+  {"jsonrpc": "2.0", "method": "notify_sum", "params": [1,2,4]},
+  {"jsonrpc": "2.0", "method": "notify_hello", "params": [7]}
+]`,
+	},
+}
+
+// ConformanceTest runs the examples of the JSON-RPC 2.0 specification
+// through handle and checks the responses. handle receives raw request bytes
+// and returns raw response bytes (nil or empty when there is no response),
+// e.g. RpcServer.HandleBytes. The server must have the methods registered by
+// RegisterSpecMethods. Error messages and the order of batch responses are
+// not compared, as the spec leaves them to the implementation.
+func ConformanceTest(t *testing.T, handle func([]byte) []byte) {
+	t.Helper()
+	for _, ex := range specExamples {
+		ex := ex
+		t.Run(ex.name, func(t *testing.T) {
+			got := bytes.TrimSpace(handle([]byte(ex.request)))
+			if ex.response == "" {
+				if len(got) != 0 {
+					t.Fatalf("expected no response, got %s", got)
+				}
+				return
+			}
+			want, err := normalize([]byte(ex.response))
+			if err != nil {
+				t.Fatalf("bad expected response: %v", err)
+			}
+			have, err := normalize(got)
+			if err != nil {
+				t.Fatalf("invalid response %q: %v", got, err)
+			}
+			if !reflect.DeepEqual(want, have) {
+				t.Fatalf("unexpected response\nwant: %s\ngot:  %s", ex.response, got)
+			}
+		})
+	}
+}
+
+// normalize decodes a response or batch of responses, dropping error
+// messages and sorting batch members.
+func normalize(raw []byte) (any, error) {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		return stripMessage(v), nil
+	case []any:
+		keys := make([]string, 0, len(v))
+		for _, item := range v {
+			obj, ok := item.(map[string]any)
+			if !ok {
+				return nil, errors.New("batch member is not an object")
+			}
+			b, err := json.Marshal(stripMessage(obj))
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, string(b))
+		}
+		sort.Strings(keys)
+		return keys, nil
+	}
+	return nil, errors.New("response is neither an object nor an array")
+}
+
+func stripMessage(resp map[string]any) map[string]any {
+	if e, ok := resp["error"].(map[string]any); ok {
+		delete(e, "message")
+		delete(e, "data")
+	}
+	return resp
+}
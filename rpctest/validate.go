@@ -0,0 +1,101 @@
+//Package rpctest provides utilities for testing JSON-RPC 2.0 servers
+//
+//Copyright (C) 2022 Alexander Kiryukhin <i@neonxp.dev>
+//
+//This file is part of go.neonxp.dev/jsonrpc2 project.
+//
+//This program is free software: you can redistribute it and/or modify
+//it under the terms of the GNU General Public License as published by
+//the Free Software Foundation, either version 3 of the License, or
+//(at your option) any later version.
+//
+//This program is distributed in the hope that it will be useful,
+//but WITHOUT ANY WARRANTY; without even the implied warranty of
+//MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//GNU General Public License for more details.
+//
+//You should have received a copy of the GNU General Public License
+//along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rpctest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// AssertValidResponse fails t unless resp, e.g. the output of
+// RpcServer.HandleBytes, is a response object or a non-empty batch of them as
+// specified by JSON-RPC 2.0: jsonrpc is "2.0", exactly one of result and
+// error is present, error has an integer code and a string message, and id
+// is a string, a number or null. An empty resp (no response) is valid.
+func AssertValidResponse(t testing.TB, resp []byte) {
+	t.Helper()
+	if err := validResponse(bytes.TrimSpace(resp)); err != nil {
+		t.Fatalf("invalid response %s: %v", resp, err)
+	}
+}
+
+func validResponse(raw []byte) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if raw[0] != '[' {
+		return validResponseObject(raw)
+	}
+	var batch []json.RawMessage
+	if err := json.Unmarshal(raw, &batch); err != nil {
+		return err
+	}
+	if len(batch) == 0 {
+		return errors.New("empty batch")
+	}
+	for i, member := range batch {
+		if err := validResponseObject(member); err != nil {
+			return fmt.Errorf("batch member %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validResponseObject(raw []byte) error {
+	var resp map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &resp); err != nil || resp == nil {
+		return errors.New("not an object")
+	}
+	var version string
+	if err := json.Unmarshal(resp["jsonrpc"], &version); err != nil || version != "2.0" {
+		return errors.New(`jsonrpc is not "2.0"`)
+	}
+	_, hasResult := resp["result"]
+	rawErr, hasError := resp["error"]
+	switch {
+	case hasResult && hasError:
+		return errors.New("both result and error")
+	case !hasResult && !hasError:
+		return errors.New("neither result nor error")
+	case hasError:
+		var e struct {
+			Code    *json.Number `json:"code"`
+			Message *string      `json:"message"`
+		}
+		if err := json.Unmarshal(rawErr, &e); err != nil || e.Code == nil || e.Message == nil {
+			return errors.New("error is not an object with code and message")
+		}
+		if _, err := e.Code.Int64(); err != nil {
+			return errors.New("error code is not an integer")
+		}
+	}
+	id, ok := resp["id"]
+	if !ok {
+		return errors.New("no id")
+	}
+	switch id[0] {
+	case '"', 'n', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return nil
+	}
+	return errors.New("id is not a string, number or null")
+}
@@ -0,0 +1,38 @@
+package rpctest
+
+import "testing"
+
+func TestValidResponse(t *testing.T) {
+	for _, resp := range []string{
+		``,
+		`{"jsonrpc":"2.0","result":1,"id":1}`,
+		`{"jsonrpc":"2.0","result":null,"id":"a"}`,
+		`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`,
+		`[{"jsonrpc":"2.0","result":1,"id":1},{"jsonrpc":"2.0","error":{"code":1,"message":"x","data":[1]},"id":2}]`,
+	} {
+		if err := validResponse([]byte(resp)); err != nil {
+			t.Errorf("%s: %v", resp, err)
+		}
+	}
+}
+
+func TestInvalidResponse(t *testing.T) {
+	for _, resp := range []string{
+		`null`,
+		`[]`,
+		`{"result":1,"id":1}`,
+		`{"jsonrpc":"1.0","result":1,"id":1}`,
+		`{"jsonrpc":"2.0","id":1}`,
+		`{"jsonrpc":"2.0","result":1,"error":{"code":1,"message":"x"},"id":1}`,
+		`{"jsonrpc":"2.0","error":{},"id":1}`,
+		`{"jsonrpc":"2.0","error":{"code":1.5,"message":"x"},"id":1}`,
+		`{"jsonrpc":"2.0","error":{"code":1},"id":1}`,
+		`{"jsonrpc":"2.0","result":1}`,
+		`{"jsonrpc":"2.0","result":1,"id":{}}`,
+		`[{"jsonrpc":"2.0","result":1,"id":1},5]`,
+	} {
+		if err := validResponse([]byte(resp)); err == nil {
+			t.Errorf("%s: expected an error", resp)
+		}
+	}
+}